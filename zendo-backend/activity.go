@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Task event types, recorded through recordChange whenever a task is
+// changed, whichever endpoint changed it.
+const (
+	eventCreated   = "created"
+	eventCompleted = "completed"
+	eventReopened  = "reopened"
+	eventMoved     = "moved"
+	eventRetagged  = "retagged"
+)
+
+// TaskEvent is a change to a task shown in its activity stream. From and To
+// hold the old and new date of a move, or the old and new tags.
+type TaskEvent struct {
+	ID        int       `json:"id"`
+	TaskID    int       `json:"taskId"`
+	Type      string    `json:"type"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ActivityItem is either a comment or an event. Type is "comment" or
+// "event".
+type ActivityItem struct {
+	Type      string     `json:"type"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Comment   *Comment   `json:"comment,omitempty"`
+	Event     *TaskEvent `json:"event,omitempty"`
+}
+
+// recordTaskEvents stores the events between two states of a task. A nil
+// before records the creation of after.
+func recordTaskEvents(ctx context.Context, q queryer, before, after *Task) error {
+	var events []TaskEvent
+	if before == nil {
+		events = append(events, TaskEvent{Type: eventCreated})
+	} else {
+		if after.Completed != before.Completed {
+			event := TaskEvent{Type: eventCompleted}
+			if !after.Completed {
+				event.Type = eventReopened
+			}
+			events = append(events, event)
+		}
+		if after.WeekDate != before.WeekDate || after.DayOfWeek != before.DayOfWeek {
+			events = append(events, TaskEvent{Type: eventMoved, From: eventDate(before), To: eventDate(after)})
+		}
+		if after.Tags != before.Tags {
+			events = append(events, TaskEvent{Type: eventRetagged, From: before.Tags, To: after.Tags})
+		}
+	}
+
+	for _, event := range events {
+		_, err := q.ExecContext(ctx, "INSERT INTO task_events (task_id, type, from_value, to_value) VALUES (?, ?, ?, ?)",
+			after.ID, event.Type, event.From, event.To)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventDate describes where a task is scheduled: its date, or the raw week
+// and day of rows that do not form one.
+func eventDate(task *Task) string {
+	if date, ok := taskDate(task); ok {
+		return date.Format("2006-01-02")
+	}
+	return task.WeekDate + " " + task.DayOfWeek
+}
+
+func queryTaskEvents(ctx context.Context, q queryer, taskID int) ([]TaskEvent, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, task_id, type, from_value, to_value, created_at FROM task_events WHERE task_id = ? ORDER BY id", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []TaskEvent
+	for rows.Next() {
+		var e TaskEvent
+		if err := rows.Scan(&e.ID, &e.TaskID, &e.Type, &e.From, &e.To, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// getTaskActivity returns the comments and events of a task, oldest first.
+func getTaskActivity(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	taskID, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := queryComments(r.Context(), db, taskID)
+	if err == nil {
+		err = renderComments(r, comments)
+	}
+	if err != nil {
+		logger.Error("Failed to load comments", "task_id", taskID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	events, err := queryTaskEvents(r.Context(), db, taskID)
+	if err != nil {
+		logger.Error("Failed to load task events", "task_id", taskID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	activity := make([]ActivityItem, 0, len(comments)+len(events))
+	for i := range events {
+		activity = append(activity, ActivityItem{Type: "event", CreatedAt: events[i].CreatedAt, Event: &events[i]})
+	}
+	for i := range comments {
+		activity = append(activity, ActivityItem{Type: "comment", CreatedAt: comments[i].CreatedAt, Comment: &comments[i]})
+	}
+	// Both lists are in order; at equal times events come first.
+	sort.SliceStable(activity, func(i, j int) bool {
+		return activity[i].CreatedAt.Before(activity[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activity)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTaskActivity(t *testing.T) {
+	c := newTestClient(t)
+
+	_, data := c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	var task Task
+	c.decode(data, &task)
+	base := fmt.Sprintf("/api/tasks/%d", task.ID)
+
+	if status, data := c.call("POST", base+"/comments", `{"author":"ana","body":"Needs a budget"}`); status != http.StatusCreated {
+		t.Fatalf("create comment: status %d, body %s", status, data)
+	}
+	// Each change reaches the stream whichever endpoint made it.
+	c.call("POST", base+"/move", `{"dayOfWeek":"tuesday"}`)
+	c.call("PUT", base, `{"title":"Plan","dayOfWeek":"tuesday","weekDate":"2024-01-07","tags":"work"}`)
+	c.call("POST", "/api/tasks/bulk", fmt.Sprintf(`{"operations":[{"op":"complete","id":%d}]}`, task.ID))
+	// Renaming alone is not an event.
+	c.call("PUT", base, `{"title":"Plan Q3","completed":true,"dayOfWeek":"tuesday","weekDate":"2024-01-07","tags":"work"}`)
+
+	_, data = c.call("GET", base+"/activity", "")
+	var activity []ActivityItem
+	c.decode(data, &activity)
+	var got []string
+	for _, item := range activity {
+		if item.Comment != nil {
+			got = append(got, "comment:"+item.Comment.Author)
+		} else {
+			got = append(got, item.Event.Type+":"+item.Event.From+">"+item.Event.To)
+		}
+	}
+	want := []string{"created:>", "comment:ana", "moved:2024-01-08>2024-01-09", "retagged:>work", "completed:>"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("activity = %v, want %v", got, want)
+	}
+
+	if status, _ := c.call("PUT", base+"/comments/1", `{"body":"Budget approved"}`); status != http.StatusOK {
+		t.Errorf("update comment: status %d", status)
+	}
+	if status, _ := c.call("DELETE", "/api/tasks/999/comments/1", ""); status != http.StatusNotFound {
+		t.Errorf("delete comment of missing task: status %d, want 404", status)
+	}
+	if status, _ := c.call("DELETE", base+"/comments/1", ""); status != http.StatusOK {
+		t.Errorf("delete comment: status %d", status)
+	}
+	_, data = c.call("GET", base+"/comments", "")
+	if strings.TrimSpace(string(data)) != "[]" {
+		t.Errorf("comments after delete = %s", data)
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Attachment files are stored once per content under
+// <dir>/<first two hex digits>/<sha256>, so uploading the same file twice
+// takes the space of one. The attachments table maps tasks to those files.
+
+// Attachment is the metadata of a file attached to a task.
+type Attachment struct {
+	ID          int       `json:"id"`
+	TaskID      int       `json:"taskId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+const attachmentColumns = "id, task_id, filename, content_type, size, sha256, created_at"
+
+// maxFilenameLength caps stored filenames, in runes.
+const maxFilenameLength = 255
+
+// multipartOverhead is the room left in an upload body for the multipart
+// headers and boundaries around the file.
+const multipartOverhead = 64 << 10
+
+// staleUploadAge is how old a leftover temporary upload must be before
+// releaseBlobs removes it.
+const staleUploadAge = 24 * time.Hour
+
+// inlineTypes are shown in the browser; everything else is downloaded.
+var inlineTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// blobMu serializes storing a file with recording it, and removing unused
+// files, so a file is never deleted between the two.
+var blobMu sync.Mutex
+
+var errQuotaExceeded = errors.New("attachment quota exceeded")
+
+func scanAttachment(row rowScanner, a *Attachment) error {
+	return row.Scan(&a.ID, &a.TaskID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.CreatedAt)
+}
+
+// loadAttachment returns sql.ErrNoRows unless the attachment belongs to the task.
+func loadAttachment(ctx context.Context, q queryer, taskID, id int) (Attachment, error) {
+	var a Attachment
+	err := scanAttachment(q.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = ? AND task_id = ?", id, taskID), &a)
+	return a, err
+}
+
+func blobPath(sum string) string {
+	return filepath.Join(config.Attachments.Dir, sum[:2], sum)
+}
+
+// isBlobPath reports whether path has the form blobPath produces.
+func isBlobPath(path string) bool {
+	sum := filepath.Base(path)
+	if len(sum) != sha256.Size*2 || filepath.Base(filepath.Dir(path)) != sum[:2] {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil && sum == strings.ToLower(sum)
+}
+
+func uploadDir() string {
+	return filepath.Join(config.Attachments.Dir, "tmp")
+}
+
+// upload is a file received into the temporary directory.
+type upload struct {
+	path        string
+	size        int64
+	sha256      string
+	contentType string
+}
+
+// receiveUpload copies r into a temporary file, hashing it and sniffing its
+// content type on the way. It fails with an *http.MaxBytesError when the
+// file is larger than limit.
+func receiveUpload(r io.Reader, filename string, limit int64) (*upload, error) {
+	if err := os.MkdirAll(uploadDir(), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(uploadDir(), "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	u := &upload{path: file.Name()}
+
+	hash := sha256.New()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(io.LimitReader(r, limit+1), head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		os.Remove(u.path)
+		return nil, err
+	}
+	head = head[:n]
+	u.contentType = detectContentType(head, filename)
+
+	size, err := io.Copy(io.MultiWriter(file, hash), io.MultiReader(bytes.NewReader(head), io.LimitReader(r, limit+1-int64(n))))
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil && size > limit {
+		err = &http.MaxBytesError{Limit: limit}
+	}
+	if err != nil {
+		os.Remove(u.path)
+		return nil, err
+	}
+	u.size = size
+	u.sha256 = hex.EncodeToString(hash.Sum(nil))
+	return u, nil
+}
+
+// detectContentType sniffs the content type from the first bytes of a file.
+// When the content gives no clue beyond plain text or binary, the filename
+// extension decides.
+func detectContentType(head []byte, filename string) string {
+	sniffed := http.DetectContentType(head)
+	if sniffed != "application/octet-stream" && !strings.HasPrefix(sniffed, "text/plain") {
+		return sniffed
+	}
+	if byExtension := mime.TypeByExtension(filepath.Ext(filename)); byExtension != "" {
+		return byExtension
+	}
+	return sniffed
+}
+
+// cleanFilename keeps the base name of an uploaded file without control
+// characters, shortened to maxFilenameLength.
+func cleanFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[:maxFilenameLength])
+	}
+	return name
+}
+
+// storeAttachment moves an upload into the blob store and records it for the
+// task, unless that would exceed the task or server quota.
+func storeAttachment(ctx context.Context, taskID int, filename string, u *upload) (Attachment, error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	defer os.Remove(u.path)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer tx.Rollback()
+
+	if limit := config.Attachments.MaxTaskBytes; limit > 0 {
+		var used int64
+		if err := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(size), 0) FROM attachments WHERE task_id = ?", taskID).Scan(&used); err != nil {
+			return Attachment{}, err
+		}
+		if used+u.size > limit {
+			return Attachment{}, errQuotaExceeded
+		}
+	}
+
+	var stored int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM attachments WHERE sha256 = ?", u.sha256).Scan(&stored); err != nil {
+		return Attachment{}, err
+	}
+	// A file that is already stored takes no more space.
+	if limit := config.Attachments.QuotaBytes; limit > 0 && stored == 0 {
+		var used int64
+		if err := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(size), 0) FROM (SELECT DISTINCT sha256, size FROM attachments)").Scan(&used); err != nil {
+			return Attachment{}, err
+		}
+		if used+u.size > limit {
+			return Attachment{}, errQuotaExceeded
+		}
+	}
+
+	path := blobPath(u.sha256)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return Attachment{}, err
+		}
+		if err := os.Rename(u.path, path); err != nil {
+			return Attachment{}, err
+		}
+	} else if err != nil {
+		return Attachment{}, err
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO attachments (task_id, filename, content_type, size, sha256) VALUES (?, ?, ?, ?, ?)",
+		taskID, filename, u.contentType, u.size, u.sha256)
+	if err != nil {
+		return Attachment{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Attachment{}, err
+	}
+	attachment, err := loadAttachment(ctx, tx, taskID, int(id))
+	if err != nil {
+		return Attachment{}, err
+	}
+	return attachment, tx.Commit()
+}
+
+// pruneBlobs removes the stored files no attachment refers to, and
+// temporary uploads left behind by a crash.
+func pruneBlobs(ctx context.Context) (int, error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	if _, err := os.Stat(config.Attachments.Dir); errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT sha256 FROM attachments")
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]bool)
+	for rows.Next() {
+		var sum string
+		if err := rows.Scan(&sum); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		referenced[sum] = true
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	err = filepath.WalkDir(config.Attachments.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if filepath.Dir(path) == filepath.Clean(uploadDir()) {
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < staleUploadAge {
+				return nil
+			}
+		} else if !isBlobPath(path) || referenced[entry.Name()] {
+			// Never touch files the store did not write.
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// releaseBlobs runs pruneBlobs after a restore or the trash purge, which may
+// delete many attachments at once. A failure only leaves unused files on
+// disk, so it is logged rather than returned.
+func releaseBlobs(ctx context.Context) {
+	removed, err := pruneBlobs(ctx)
+	if err != nil {
+		slog.Warn("Removing unused attachment files failed", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Info("Removed unused attachment files", "count", removed)
+	}
+}
+
+// removeAttachment deletes one attachment and its file, unless another
+// attachment has the same content. Unlike pruneBlobs it only looks at that
+// file, so deleting an attachment does not scan the whole store.
+func removeAttachment(ctx context.Context, a Attachment) error {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM attachments WHERE id = ?", a.ID); err != nil {
+		return err
+	}
+
+	var refs int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM attachments WHERE sha256 = ?", a.SHA256).Scan(&refs); err != nil {
+		return err
+	}
+	if refs > 0 {
+		return nil
+	}
+	// A failure only leaves an unused file for the next prune.
+	if err := os.Remove(blobPath(a.SHA256)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Removing attachment file failed", "sha256", a.SHA256, "error", err)
+	}
+	return nil
+}
+
+// pathAttachment loads the attachment named by the path, writing the problem
+// response when it does not exist.
+func pathAttachment(w http.ResponseWriter, r *http.Request) (Attachment, bool) {
+	logger := requestLogger(r)
+
+	taskID, ok := pathTask(w, r)
+	if !ok {
+		return Attachment{}, false
+	}
+
+	idStr := r.PathValue("attachmentId")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid attachment ID", "id", idStr, "error", err)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidID, "Attachment ID must be an integer")
+		return Attachment{}, false
+	}
+
+	attachment, err := loadAttachment(r.Context(), db, taskID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Attachment not found", "task_id", taskID, "attachment_id", id)
+		writeProblem(w, r, http.StatusNotFound, codeAttachmentNotFound, "Attachment not found")
+		return Attachment{}, false
+	}
+	if err != nil {
+		logger.Error("Database query failed", "attachment_id", id, "error", err)
+		writeInternalError(w, r)
+		return Attachment{}, false
+	}
+	return attachment, true
+}
+
+func listAttachments(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	taskID, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), "SELECT "+attachmentColumns+" FROM attachments WHERE task_id = ? ORDER BY id", taskID)
+	if err != nil {
+		logger.Error("Database query failed", "task_id", taskID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			logger.Error("Failed to scan attachment", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("Database query failed", "task_id", taskID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// uploadAttachment stores the multipart/form-data part named "file".
+func uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	taskID, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+
+	limit := config.Attachments.MaxFileBytes
+	r.Body = http.MaxBytesReader(w, r.Body, limit+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		logger.Warn("Upload is not multipart", "content_type", r.Header.Get("Content-Type"))
+		writeProblem(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType,
+			"Attachments must be uploaded as multipart/form-data")
+		return
+	}
+
+	var u *upload
+	var filename string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Warn("Invalid multipart body", "error", err)
+			writeUploadError(w, r, err)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		filename = cleanFilename(part.FileName())
+		u, err = receiveUpload(part, filename, limit)
+		part.Close()
+		if err != nil {
+			logger.Warn("Upload failed", "task_id", taskID, "error", err)
+			writeUploadError(w, r, err)
+			return
+		}
+		break
+	}
+	if u == nil {
+		writeValidationError(w, r, []FieldError{{Field: "file", Code: fieldRequired, Message: "a file part named file is required"}})
+		return
+	}
+	if u.size == 0 {
+		os.Remove(u.path)
+		writeValidationError(w, r, []FieldError{{Field: "file", Code: fieldInvalid, Message: "must not be empty"}})
+		return
+	}
+
+	attachment, err := storeAttachment(r.Context(), taskID, filename, u)
+	if errors.Is(err, errQuotaExceeded) {
+		logger.Warn("Attachment quota exceeded", "task_id", taskID, "size", u.size)
+		writeProblem(w, r, http.StatusInsufficientStorage, codeQuotaExceeded,
+			"Storing the file would exceed the attachment quota")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to store attachment", "task_id", taskID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Attachment uploaded", "task_id", taskID, "attachment_id", attachment.ID, "size", attachment.Size, "content_type", attachment.ContentType)
+	logger.Debug("Attachment details", "attachment", attachment)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// writeUploadError reports a body that was too large with 413 and any other
+// read failure as a malformed request.
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+			"The file is larger than "+strconv.FormatInt(config.Attachments.MaxFileBytes, 10)+" bytes")
+		return
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || strings.HasPrefix(err.Error(), "multipart:") {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "The multipart body is malformed")
+		return
+	}
+	writeInternalError(w, r)
+}
+
+// downloadAttachment serves the file, with range requests and conditional
+// requests on its ETag, the SHA-256 of the content.
+func downloadAttachment(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	attachment, ok := pathAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := os.Open(blobPath(attachment.SHA256))
+	if errors.Is(err, fs.ErrNotExist) {
+		// The record may have been restored from a snapshot without the files.
+		logger.Error("Attachment file is missing", "attachment_id", attachment.ID, "sha256", attachment.SHA256)
+		writeProblem(w, r, http.StatusNotFound, codeAttachmentNotFound, "The attachment file is missing")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to open attachment", "attachment_id", attachment.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer file.Close()
+
+	disposition := "attachment"
+	mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+	if inlineTypes[mediaType] && r.URL.Query().Get("download") == "" {
+		disposition = "inline"
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", attachment.ContentType)
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	header.Set("ETag", `"`+attachment.SHA256+`"`)
+	header.Set("Cache-Control", "private, no-cache")
+	// Uploaded content must never run as part of the app.
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(w, r, attachment.Filename, attachment.CreatedAt, file)
+}
+
+func deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	attachment, ok := pathAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	if err := removeAttachment(r.Context(), attachment); err != nil {
+		logger.Error("Database delete failed", "attachment_id", attachment.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Attachment deleted", "task_id", attachment.TaskID, "attachment_id", attachment.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Attachment deleted successfully"})
+}
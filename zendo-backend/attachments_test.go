@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttachments(t *testing.T) {
+	server := newTestServer(t)
+	week := getWeekStart(time.Now().In(timezone)).Format("2006-01-02")
+
+	do := func(req *http.Request) (*http.Response, []byte) {
+		t.Helper()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+	call := func(method, path string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return do(req)
+	}
+	createTask := func(title string) int {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/api/tasks", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"title":%q,"dayOfWeek":"monday","weekDate":%q}`, title, week)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var task Task
+		if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+			t.Fatal(err)
+		}
+		return task.ID
+	}
+	upload := func(taskID int, filename, content string) (int, Attachment) {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, content)
+		form.Close()
+		req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/tasks/%d/attachments", server.URL, taskID), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, data := do(req)
+		var attachment Attachment
+		if resp.StatusCode == http.StatusCreated {
+			if err := json.Unmarshal(data, &attachment); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, attachment
+	}
+
+	first, second := createTask("Report"), createTask("Review")
+	content := "%PDF-1.4 quarterly report"
+	status, a := upload(first, "../report.pdf", content)
+	if status != http.StatusCreated {
+		t.Fatalf("upload: status %d", status)
+	}
+	if a.Filename != "report.pdf" || a.ContentType != "application/pdf" || a.Size != int64(len(content)) {
+		t.Errorf("upload: got %+v", a)
+	}
+	status, b := upload(second, "copy.pdf", content)
+	if status != http.StatusCreated || b.SHA256 != a.SHA256 {
+		t.Fatalf("second upload: status %d, %+v", status, b)
+	}
+
+	resp, body := call("GET", fmt.Sprintf("/api/tasks/%d/attachments", first))
+	var list []Attachment
+	if err := json.Unmarshal(body, &list); err != nil || len(list) != 1 || list[0].ID != a.ID {
+		t.Fatalf("list: status %d, body %s", resp.StatusCode, body)
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/tasks/%d/attachments/%d", server.URL, first, a.ID), nil)
+	req.Header.Set("Range", "bytes=9-17")
+	resp, body = do(req)
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "quarterly" {
+		t.Errorf("range download: status %d, body %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("ETag"); got != `"`+a.SHA256+`"` {
+		t.Errorf("ETag = %q", got)
+	}
+
+	// The other task's attachment of the same file is not under this task.
+	resp, _ = call("GET", fmt.Sprintf("/api/tasks/%d/attachments/%d", first, b.ID))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("foreign attachment: status %d, want 404", resp.StatusCode)
+	}
+
+	// The shared file outlives the first task and goes with the last reference.
+	call("DELETE", fmt.Sprintf("/api/tasks/%d", first))
+	resp, _ = call("DELETE", fmt.Sprintf("/api/tasks/%d/attachments/%d", second, b.ID))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: status %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(blobPath(a.SHA256)); err != nil {
+		t.Fatalf("file of a trashed task removed: %v", err)
+	}
+	if _, err := purgeTrash(context.Background(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(blobPath(a.SHA256)); !os.IsNotExist(err) {
+		t.Errorf("unreferenced file still stored: %v", err)
+	}
+
+	// Deleting an attachment removes its own file, but does not sweep the
+	// store: that is left to the purge and restore.
+	stray := blobPath(strings.Repeat("ab", 32))
+	if err := os.MkdirAll(filepath.Dir(stray), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stray, []byte("stray"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, c := upload(second, "notes.txt", "meeting notes")
+	if status != http.StatusCreated {
+		t.Fatalf("upload notes: status %d", status)
+	}
+	if resp, _ := call("DELETE", fmt.Sprintf("/api/tasks/%d/attachments/%d", second, c.ID)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete notes: status %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(blobPath(c.SHA256)); !os.IsNotExist(err) {
+		t.Errorf("file of the deleted attachment still stored: %v", err)
+	}
+	if _, err := os.Stat(stray); err != nil {
+		t.Errorf("deleting an attachment removed an unrelated file: %v", err)
+	}
+
+	config.Attachments.MaxTaskBytes = 10
+	if status, _ := upload(second, "big.txt", "more than ten bytes"); status != http.StatusInsufficientStorage {
+		t.Errorf("over quota: status %d, want 507", status)
+	}
+}
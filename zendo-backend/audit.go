@@ -0,0 +1,513 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Every change to a task is kept in the audit log with the full task before
+// and after it, so any earlier revision can be restored. Records are written
+// by recordChange, which the functions in tasks.go call inside the same
+// transaction as the change itself.
+
+// Audit actions.
+const (
+	auditCreate  = "create"
+	auditUpdate  = "update"
+	auditDelete  = "delete"
+	auditRevert  = "revert"
+	auditRestore = "restore"
+)
+
+// auditSources are the values accepted in X-Zendo-Source. Requests without
+// the header come from the web app.
+var auditSources = []string{"web", "cli", "sync", "import"}
+
+// maxActorLength caps the X-Zendo-Actor header, in characters.
+const maxActorLength = 100
+
+// auditIgnoredFields are derived or bookkeeping fields left out of the
+// changes of a record.
+var auditIgnoredFields = map[string]bool{"updatedAt": true, "checklist": true, "descriptionHtml": true}
+
+// AuditRecord is one change to a task. Before is missing for a creation or a
+// restore from the trash and After for a deletion; Changes lists the fields an update or revert changed.
+type AuditRecord struct {
+	ID         int                    `json:"id"`
+	TaskID     int                    `json:"taskId"`
+	Action     string                 `json:"action"`
+	Actor      string                 `json:"actor,omitempty"`
+	Source     string                 `json:"source"`
+	Before     *Task                  `json:"before,omitempty"`
+	After      *Task                  `json:"after,omitempty"`
+	Changes    map[string]FieldChange `json:"changes,omitempty"`
+	RevertedTo int                    `json:"revertedTo,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// FieldChange is the old and new JSON value of a task field.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// RevertTaskRequest is the body of POST /api/tasks/{id}/revert. Revision is
+// the ID of the audit record whose resulting state is restored.
+type RevertTaskRequest struct {
+	Revision int `json:"revision"`
+}
+
+// auditInfo says who made the changes of a request and through what.
+// Changes made with a Session are journaled under the request's Operation
+// so they can be undone, see undo.go.
+type auditInfo struct {
+	Actor      string
+	Source     string
+	RevertedTo int
+	Session    string
+	Operation  string
+}
+
+type auditKey struct{}
+
+func auditFrom(ctx context.Context) auditInfo {
+	if info, ok := ctx.Value(auditKey{}).(auditInfo); ok {
+		return info
+	}
+	return auditInfo{Source: auditSources[0]}
+}
+
+func withAudit(ctx context.Context, info auditInfo) context.Context {
+	return context.WithValue(ctx, auditKey{}, info)
+}
+
+// auditContext reads the X-Zendo-Actor, X-Zendo-Source and X-Zendo-Session
+// headers into the request context. All are declared by the client and not
+// verified, except that requests with an API user's token are attributed to
+// that user whatever X-Zendo-Actor says.
+func auditContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := auditInfo{Source: auditSources[0]}
+
+		if source := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Zendo-Source"))); source != "" {
+			if !slices.Contains(auditSources, source) {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid header",
+					FieldError{Field: "X-Zendo-Source", Code: fieldInvalid, Message: "must be one of " + strings.Join(auditSources, ", ")})
+				return
+			}
+			info.Source = source
+		}
+
+		info.Actor = strings.TrimSpace(strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, r.Header.Get("X-Zendo-Actor")))
+		if n := utf8.RuneCountInString(info.Actor); n > maxActorLength {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid header",
+				FieldError{Field: "X-Zendo-Actor", Code: fieldTooLong, Message: "must be at most " + strconv.Itoa(maxActorLength) + " characters"})
+			return
+		}
+
+		if user := userFrom(r.Context()); user != "" {
+			info.Actor = user
+		}
+
+		if session := r.Header.Get("X-Zendo-Session"); session != "" {
+			if !validRequestID(session) {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid header",
+					FieldError{Field: "X-Zendo-Session", Code: fieldInvalid, Message: "must be at most 64 letters, digits, dots, dashes or underscores"})
+				return
+			}
+			info.Session, info.Operation = session, newRequestID()
+		}
+
+		next.ServeHTTP(w, r.WithContext(withAudit(r.Context(), info)))
+	})
+}
+
+// recordChange writes the activity events and the audit record for a change
+// to a task. A nil before is a creation and a nil after a deletion.
+func recordChange(ctx context.Context, q queryer, before, after *Task) error {
+	if after != nil {
+		if err := recordTaskEvents(ctx, q, before, after); err != nil {
+			return err
+		}
+	}
+
+	info := auditFrom(ctx)
+	var action string
+	var taskID int
+	switch {
+	case before == nil:
+		action, taskID = auditCreate, after.ID
+	case after == nil:
+		action, taskID = auditDelete, before.ID
+	case info.RevertedTo != 0:
+		action, taskID = auditRevert, after.ID
+	default:
+		action, taskID = auditUpdate, after.ID
+		// Saving a task unchanged is not worth a revision.
+		if len(taskChanges(before, after)) == 0 {
+			return nil
+		}
+	}
+
+	return writeAuditRecord(ctx, q, action, taskID, before, after)
+}
+
+// writeAuditRecord stores one audit record with the actor and source of the
+// request.
+func writeAuditRecord(ctx context.Context, q queryer, action string, taskID int, before, after *Task) error {
+	info := auditFrom(ctx)
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO audit_log (task_id, action, actor, source, before, after, reverted_to) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		taskID, action, info.Actor, info.Source, beforeJSON, afterJSON, info.RevertedTo)
+	if err != nil {
+		return err
+	}
+	return journalChange(ctx, q, taskID, beforeJSON, afterJSON)
+}
+
+// auditJSON encodes a task for the audit log, or NULL for a nil one.
+func auditJSON(task *Task) (interface{}, error) {
+	if task == nil {
+		return nil, nil
+	}
+	stored := *task
+	stored.DescriptionHTML = ""
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
+
+// taskChanges compares two task states by their JSON fields.
+func taskChanges(before, after *Task) map[string]FieldChange {
+	from, to := taskJSONFields(before), taskJSONFields(after)
+	changes := make(map[string]FieldChange)
+	for name, value := range to {
+		if !auditIgnoredFields[name] && !reflect.DeepEqual(from[name], value) {
+			changes[name] = FieldChange{From: from[name], To: value}
+		}
+	}
+	// Omitted fields such as projectId can be cleared.
+	for name, value := range from {
+		if _, ok := to[name]; !ok && !auditIgnoredFields[name] {
+			changes[name] = FieldChange{From: value}
+		}
+	}
+	return changes
+}
+
+func taskJSONFields(task *Task) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := json.Marshal(task)
+	if err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+const auditColumns = "id, task_id, action, actor, source, before, after, reverted_to, created_at"
+
+func scanAuditRecord(row rowScanner, record *AuditRecord) error {
+	var before, after sql.NullString
+	if err := row.Scan(&record.ID, &record.TaskID, &record.Action, &record.Actor, &record.Source, &before, &after, &record.RevertedTo, &record.CreatedAt); err != nil {
+		return err
+	}
+	var err error
+	if record.Before, err = decodeTaskState(before); err != nil {
+		return err
+	}
+	if record.After, err = decodeTaskState(after); err != nil {
+		return err
+	}
+	if record.Before != nil && record.After != nil {
+		record.Changes = taskChanges(record.Before, record.After)
+	}
+	return nil
+}
+
+// decodeTaskState reads a task stored by auditJSON, or nil for NULL.
+func decodeTaskState(data sql.NullString) (*Task, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(data.String), &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func queryAuditRecords(ctx context.Context, q queryer, where string, args ...interface{}) ([]AuditRecord, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_log WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []AuditRecord{}
+	for rows.Next() {
+		var record AuditRecord
+		if err := scanAuditRecord(rows, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// auditFilters holds the query parameters of GET /api/audit.
+type auditFilters struct {
+	where string
+	args  []interface{}
+	limit int
+}
+
+// Audit pages hold defaultAuditLimit records unless ?limit= asks for more,
+// up to maxAuditLimit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// parseAuditFilters reads the taskId, actor, source, action, since, until,
+// before and limit query parameters.
+func parseAuditFilters(r *http.Request) (auditFilters, []FieldError) {
+	filters := auditFilters{where: "1 = 1", limit: defaultAuditLimit}
+	var fieldErrors []FieldError
+	query := r.URL.Query()
+	invalid := func(field, message string) {
+		fieldErrors = append(fieldErrors, FieldError{Field: field, Code: fieldInvalid, Message: message})
+	}
+
+	for _, param := range []struct{ name, column string }{{"taskId", "task_id"}, {"before", "id"}} {
+		s := query.Get(param.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			invalid(param.name, "must be a positive integer")
+			continue
+		}
+		op := " = ?"
+		if param.name == "before" {
+			op = " < ?"
+		}
+		filters.where += " AND " + param.column + op
+		filters.args = append(filters.args, n)
+	}
+
+	if actor := query.Get("actor"); actor != "" {
+		filters.where += " AND actor = ?"
+		filters.args = append(filters.args, actor)
+	}
+	if source := query.Get("source"); source != "" {
+		if slices.Contains(auditSources, source) {
+			filters.where += " AND source = ?"
+			filters.args = append(filters.args, source)
+		} else {
+			invalid("source", "must be one of "+strings.Join(auditSources, ", "))
+		}
+	}
+	if action := query.Get("action"); action != "" {
+		if slices.Contains([]string{auditCreate, auditUpdate, auditDelete, auditRevert, auditRestore}, action) {
+			filters.where += " AND action = ?"
+			filters.args = append(filters.args, action)
+		} else {
+			invalid("action", "must be create, update, delete, revert or restore")
+		}
+	}
+
+	// since and until take a date in the server timezone or an RFC 3339
+	// time; a date in until includes the whole day.
+	for _, param := range []string{"since", "until"} {
+		s := query.Get(param)
+		if s == "" {
+			continue
+		}
+		op := " >= ?"
+		if param == "until" {
+			op = " <= ?"
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			day, dayErr := time.ParseInLocation("2006-01-02", s, timezone)
+			if dayErr != nil {
+				invalid(param, "must be a date in YYYY-MM-DD format or an RFC 3339 time")
+				continue
+			}
+			t = day
+			if param == "until" {
+				t, op = day.AddDate(0, 0, 1), " < ?"
+			}
+		}
+		filters.where += " AND created_at" + op
+		filters.args = append(filters.args, t.UTC().Format("2006-01-02 15:04:05.000"))
+	}
+
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			invalid("limit", "must be an integer from 1 to "+strconv.Itoa(maxAuditLimit))
+		} else {
+			filters.limit = n
+		}
+	}
+	return filters, fieldErrors
+}
+
+// getAuditLog lists audit records, newest first. Pass the smallest ID of a
+// page as ?before= to get the next one.
+func getAuditLog(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	filters, fieldErrors := parseAuditFilters(r)
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
+	}
+
+	records, err := queryAuditRecords(r.Context(), db, filters.where+" ORDER BY id DESC LIMIT ?", append(filters.args, filters.limit)...)
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// getTaskHistory lists the revisions of a task, newest first. The history
+// of a deleted task remains available.
+func getTaskHistory(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
+		return
+	}
+
+	records, err := queryAuditRecords(r.Context(), db, "task_id = ? ORDER BY id DESC", id)
+	if err != nil {
+		logger.Error("Database query failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if len(records) == 0 {
+		// Tasks from before the audit log have no records but do exist.
+		if _, ok := pathTask(w, r); !ok {
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// revertTask restores the task to the state it had after the given
+// revision. The revert is itself recorded, so it can be reverted too.
+func revertTask(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
+		return
+	}
+
+	var req RevertTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := loadTask(r.Context(), tx, id); errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
+		return
+	} else if err != nil {
+		logger.Error("Database query failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	records, err := queryAuditRecords(r.Context(), tx, "id = ? AND task_id = ?", req.Revision, id)
+	if err != nil {
+		logger.Error("Database query failed", "revision", req.Revision, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if len(records) == 0 {
+		writeValidationError(w, r, []FieldError{{Field: "revision", Code: fieldInvalid, Message: "must be the ID of a revision of this task"}})
+		return
+	}
+	state := records[0].After
+	if state == nil {
+		writeValidationError(w, r, []FieldError{{Field: "revision", Code: fieldInvalid, Message: "must not be a deletion"}})
+		return
+	}
+
+	info := auditFrom(r.Context())
+	info.RevertedTo = req.Revision
+	ctx := withAudit(r.Context(), info)
+
+	// Stored states were valid when written; only the format is rechecked.
+	fields := fieldsOf(state)
+	if fieldErrors := fields.normalize(); len(fieldErrors) > 0 {
+		logger.Error("Revision does not hold a valid task", "revision", req.Revision, "errors", fieldErrors)
+		writeInternalError(w, r)
+		return
+	}
+	fields.ProjectID, err = existingProject(ctx, tx, fields.ProjectID)
+	var task Task
+	if err == nil {
+		task, err = saveTask(ctx, tx, id, fields, state.Completed)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Database update failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Task reverted", "task_id", id, "revision", req.Revision)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
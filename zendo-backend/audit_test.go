@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuditHistoryAndRevert(t *testing.T) {
+	c := newTestClient(t)
+
+	history := func(path string) []AuditRecord {
+		t.Helper()
+		_, data := c.call("GET", path, "")
+		var records []AuditRecord
+		c.decode(data, &records)
+		return records
+	}
+
+	_, data := c.call("POST", "/api/tasks", `{"title":"Draft","dayOfWeek":"monday","weekDate":"2024-01-07"}`,
+		"X-Zendo-Actor", "ana", "X-Zendo-Source", "cli")
+	var task Task
+	c.decode(data, &task)
+	base := fmt.Sprintf("/api/tasks/%d", task.ID)
+	c.call("PUT", base, `{"title":"Final","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	// Saving the same state again is not a revision.
+	c.call("PUT", base, `{"title":"Final","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+
+	records := history(base + "/history")
+	if len(records) != 2 {
+		t.Fatalf("history has %d records, want 2", len(records))
+	}
+	update, create := records[0], records[1]
+	if create.Action != auditCreate || create.Actor != "ana" || create.Source != "cli" || create.Before != nil {
+		t.Errorf("create record = %+v", create)
+	}
+	if update.Action != auditUpdate || update.Source != "web" || len(update.Changes) != 1 ||
+		update.Changes["title"].From != "Draft" || update.Changes["title"].To != "Final" {
+		t.Errorf("update record = %+v", update)
+	}
+
+	status, data := c.call("POST", base+"/revert", fmt.Sprintf(`{"revision":%d}`, create.ID))
+	if status != http.StatusOK {
+		t.Fatalf("revert: status %d, body %s", status, data)
+	}
+	if err := json.Unmarshal(data, &task); err != nil || task.Title != "Draft" {
+		t.Errorf("reverted task = %s", data)
+	}
+	revert := history(base + "/history")[0]
+	if revert.Action != auditRevert || revert.RevertedTo != create.ID {
+		t.Errorf("revert record = %+v", revert)
+	}
+	if status, _ := c.call("POST", base+"/revert", `{"revision":999}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("revert to unknown revision: status %d, want 422", status)
+	}
+	if status, _ := c.call("GET", "/api/tasks/999/history", ""); status != http.StatusNotFound {
+		t.Errorf("history of missing task: status %d, want 404", status)
+	}
+	if status, _ := c.call("GET", "/api/tasks", "", "X-Zendo-Source", "fax"); status != http.StatusBadRequest {
+		t.Errorf("unknown source: status %d, want 400", status)
+	}
+
+	// The history survives the task.
+	c.call("DELETE", base, "")
+	if got := history(base + "/history"); len(got) != 4 || got[0].Action != auditDelete {
+		t.Errorf("history after delete has %d records", len(got))
+	}
+	if got := history("/api/audit?actor=ana"); len(got) != 1 || got[0].ID != create.ID {
+		t.Errorf("audit filtered by actor = %+v", got)
+	}
+	if got := history("/api/audit?action=update&limit=1"); len(got) != 1 || got[0].ID != update.ID {
+		t.Errorf("audit filtered by action = %+v", got)
+	}
+}
+
+func TestParseAuditFilters(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/audit?actor=sam&source=fax&action=shred", nil)
+	filters, fieldErrors := parseAuditFilters(r)
+	if len(fieldErrors) != 2 || fieldErrors[0].Field != "source" || fieldErrors[1].Field != "action" {
+		t.Errorf("field errors = %+v, want source and action", fieldErrors)
+	}
+	// Invalid values add no conditions, so the filters stay consistent.
+	if filters.where != "1 = 1 AND actor = ?" || len(filters.args) != 1 {
+		t.Errorf("filters = %q %v, want only the actor", filters.where, filters.args)
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupFormatVersion is the version of the JSON snapshot layout itself,
+// independent of the database schema version it was taken from.
+const backupFormatVersion = 1
+
+// backupTables lists the tables included in a snapshot, in restore order.
+// Attachment files are not part of snapshots; back up the attachments
+// directory alongside them.
+var backupTables = []string{"tasks", "attachments", "comments", "task_events", "audit_log", "templates", "template_tasks", "projects", "users"}
+
+// BackupSnapshot is a full JSON snapshot of the database.
+type BackupSnapshot struct {
+	Version       int                                 `json:"version"`
+	SchemaVersion int                                 `json:"schemaVersion"`
+	CreatedAt     time.Time                           `json:"createdAt"`
+	Tables        map[string][]map[string]interface{} `json:"tables"`
+}
+
+// snapshotUpgrades migrates a snapshot from the keyed schema version to the next one.
+var snapshotUpgrades = map[int]func(*BackupSnapshot){
+	// Version 0 snapshots predate schema versioning and may lack week_date and tags.
+	0: func(s *BackupSnapshot) {
+		weekDate := getWeekStart(time.Now().In(timezone)).Format("2006-01-02")
+		for _, row := range s.Tables["tasks"] {
+			if row["week_date"] == nil {
+				row["week_date"] = weekDate
+			}
+			if row["tags"] == nil {
+				row["tags"] = ""
+			}
+		}
+	},
+}
+
+// requireAdmin rejects requests without the configured admin token. When no
+// token is configured the admin endpoints are disabled, as a backup exposes
+// every table and a restore replaces them.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminToken == "" {
+			requestLogger(r).Warn("Rejected admin request, no admin token is configured")
+			writeProblem(w, r, http.StatusForbidden, codeAdminDisabled, "Admin endpoints are disabled until an admin token is configured")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			requestLogger(r).Warn("Rejected admin request")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zendo admin"`)
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "A valid admin token is required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func backupDatabase(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	snapshot, err := createSnapshot()
+	if err != nil {
+		logger.Error("Failed to create snapshot", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	filename := fmt.Sprintf("zendo-backup-%s.json", snapshot.CreatedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+func restoreDatabase(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	// Snapshots are far larger than other request bodies, so they have
+	// their own cap instead of limitBody.
+	r.Body = http.MaxBytesReader(w, r.Body, config.Backup.MaxRestoreBytes)
+	snapshot, err := decodeSnapshot(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		logger.Warn("Snapshot too large", "limit", tooLarge.Limit)
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+			fmt.Sprintf("The snapshot is larger than the limit of %d bytes", tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		logger.Warn("Invalid snapshot", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidSnapshot, err.Error())
+		return
+	}
+
+	counts, err := restoreSnapshot(snapshot)
+	if err != nil {
+		logger.Error("Restore failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Database restored successfully",
+		"restored": counts,
+	})
+}
+
+// createSnapshot reads every backed up table inside a single read transaction
+// so the snapshot is consistent even while the server keeps writing.
+func createSnapshot() (*BackupSnapshot, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	snapshot := &BackupSnapshot{
+		Version:       backupFormatVersion,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Tables:        make(map[string][]map[string]interface{}),
+	}
+
+	for _, table := range backupTables {
+		rows, err := tx.Query("SELECT * FROM " + table)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", table, err)
+		}
+		tableRows, err := scanRowMaps(rows)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", table, err)
+		}
+		snapshot.Tables[table] = tableRows
+	}
+
+	return snapshot, nil
+}
+
+// scanRowMaps scans every row into a column name to value map and closes rows.
+func scanRowMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// decodeSnapshot parses a snapshot, validates its versions and upgrades it
+// to the current schema version.
+func decodeSnapshot(body io.Reader) (*BackupSnapshot, error) {
+	var snapshot BackupSnapshot
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot JSON: %w", err)
+	}
+
+	if snapshot.Version != backupFormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %d", snapshot.Version)
+	}
+	if snapshot.SchemaVersion > schemaVersion {
+		return nil, fmt.Errorf("snapshot schema version %d is newer than server schema version %d", snapshot.SchemaVersion, schemaVersion)
+	}
+	if snapshot.SchemaVersion < 0 {
+		return nil, fmt.Errorf("invalid snapshot schema version %d", snapshot.SchemaVersion)
+	}
+	if snapshot.Tables == nil {
+		return nil, fmt.Errorf("snapshot has no tables")
+	}
+	for table := range snapshot.Tables {
+		if !isBackupTable(table) {
+			return nil, fmt.Errorf("snapshot contains unknown table %q", table)
+		}
+	}
+
+	for v := snapshot.SchemaVersion; v < schemaVersion; v++ {
+		if upgrade, ok := snapshotUpgrades[v]; ok {
+			slog.Info("Upgrading snapshot", "from_schema_version", v, "to_schema_version", v+1)
+			upgrade(&snapshot)
+		}
+	}
+	snapshot.SchemaVersion = schemaVersion
+
+	return &snapshot, nil
+}
+
+func isBackupTable(name string) bool {
+	for _, table := range backupTables {
+		if table == name {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreSnapshot replaces the contents of every backed up table with the
+// snapshot data in one transaction, so a failed restore leaves the database untouched.
+func restoreSnapshot(snapshot *BackupSnapshot) (map[string]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := make(map[string]int)
+
+	// Clear tables in reverse order so dependent tables go first.
+	for i := len(backupTables) - 1; i >= 0; i-- {
+		if _, err := tx.Exec("DELETE FROM " + backupTables[i]); err != nil {
+			return nil, fmt.Errorf("clearing %s: %w", backupTables[i], err)
+		}
+	}
+
+	for _, table := range backupTables {
+		columnTypes, err := tableColumnTypes(tx, table)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range snapshot.Tables[table] {
+			var columns []string
+			var args []interface{}
+			for column, value := range row {
+				columnType, ok := columnTypes[column]
+				if !ok {
+					// Columns that no longer exist are dropped.
+					continue
+				}
+				columns = append(columns, column)
+				args = append(args, snapshotValue(value, columnType))
+			}
+			if len(columns) == 0 {
+				continue
+			}
+
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+			query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders)
+			if _, err := tx.Exec(query, args...); err != nil {
+				return nil, fmt.Errorf("restoring %s: %w", table, err)
+			}
+			counts[table]++
+		}
+	}
+
+	// Operations journaled before the restore cannot be undone after it.
+	for _, table := range []string{"operation_tasks", "operations"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return nil, fmt.Errorf("clearing %s: %w", table, err)
+		}
+	}
+
+	// Snapshots taken before schema version 2 have no task positions.
+	if _, err := assignMissingPositions(context.Background(), tx); err != nil {
+		return nil, fmt.Errorf("assigning task positions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	releaseBlobs(context.Background())
+
+	slog.Info("Restored snapshot", "taken_at", snapshot.CreatedAt.Format(time.RFC3339), "rows", counts)
+	return counts, nil
+}
+
+// tableColumnTypes returns the declared type of every column in table.
+func tableColumnTypes(tx *sql.Tx, table string) (map[string]string, error) {
+	rows, err := tx.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, columnType string
+		if err := rows.Scan(&name, &columnType); err != nil {
+			return nil, err
+		}
+		types[name] = strings.ToUpper(columnType)
+	}
+	return types, rows.Err()
+}
+
+// snapshotValue converts a decoded JSON value back into a value suitable for
+// a column of the given declared type.
+func snapshotValue(value interface{}, columnType string) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		// Timestamps are exported as RFC 3339; store them in the same
+		// format CURRENT_TIMESTAMP uses so ordering stays consistent, or
+		// nowMillis for the timestamps that have milliseconds.
+		if columnType == "DATETIME" {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				if t.Nanosecond() != 0 {
+					return t.UTC().Format("2006-01-02 15:04:05.000")
+				}
+				return t.UTC().Format("2006-01-02 15:04:05")
+			}
+		}
+		return v
+	}
+	return value
+}
+
+// startBackupScheduler writes periodic snapshots to disk when a backup
+// interval is configured, keeping only the newest Backup.Keep files. It stops
+// when ctx is cancelled, letting a running backup finish.
+func startBackupScheduler(ctx context.Context) {
+	if config.Backup.Interval == "" {
+		return
+	}
+
+	// The interval was checked when the config was loaded.
+	interval, _ := time.ParseDuration(config.Backup.Interval)
+	dir, keep := config.Backup.Dir, config.Backup.Keep
+
+	slog.Info("Scheduled backups enabled", "interval", interval, "dir", dir, "keep", keep)
+
+	backgroundJobs.Add(1)
+	go func() {
+		defer backgroundJobs.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			path, err := writeBackupFile(dir)
+			if err != nil {
+				slog.Error("Scheduled backup failed", "error", err)
+				backupRunsTotal.inc("error")
+				continue
+			}
+			slog.Info("Scheduled backup written", "path", path)
+			backupRunsTotal.inc("success")
+			if err := pruneBackups(dir, keep); err != nil {
+				slog.Error("Failed to prune old backups", "error", err)
+			}
+		}
+	}()
+}
+
+// writeBackupFile writes a snapshot into dir and returns its path. The file is
+// written under a temporary name and renamed so partial backups are never kept.
+func writeBackupFile(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	snapshot, err := createSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("zendo-backup-%s.json", snapshot.CreatedAt.Format("20060102-150405")))
+	tmp, err := os.CreateTemp(dir, ".zendo-backup-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// pruneBackups removes all but the newest keep backup files in dir.
+func pruneBackups(dir string, keep int) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "zendo-backup-*.json"))
+	if err != nil {
+		return err
+	}
+	if len(matches) <= keep {
+		return nil
+	}
+
+	// Timestamped names sort chronologically.
+	sort.Strings(matches)
+	for _, path := range matches[:len(matches)-keep] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		slog.Info("Removed old backup", "path", path)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	c := newTestClient(t)
+	saved := config.AdminToken
+	config.AdminToken = "secret"
+	t.Cleanup(func() { config.AdminToken = saved })
+	admin := func(method, path, body string) (int, []byte) {
+		return c.call(method, path, body, "Authorization", "Bearer secret")
+	}
+
+	_, data := c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07","tags":"work","urgent":true}`)
+	var task Task
+	c.decode(data, &task)
+	c.call("POST", fmt.Sprintf("/api/tasks/%d/comments", task.ID), `{"author":"ana","body":"Soon"}`)
+
+	status, backup := admin("GET", "/api/admin/backup", "")
+	if status != http.StatusOK {
+		t.Fatalf("backup: status %d, body %s", status, backup)
+	}
+	var snapshot BackupSnapshot
+	c.decode(backup, &snapshot)
+	if snapshot.SchemaVersion != schemaVersion || len(snapshot.Tables["tasks"]) != 1 || len(snapshot.Tables["comments"]) != 1 {
+		t.Fatalf("snapshot = %s", backup)
+	}
+
+	c.call("DELETE", fmt.Sprintf("/api/tasks/%d", task.ID), "")
+	c.call("POST", "/api/tasks", `{"title":"Later","dayOfWeek":"friday","weekDate":"2024-01-07"}`)
+
+	if status, data := admin("POST", "/api/admin/restore", string(backup)); status != http.StatusOK {
+		t.Fatalf("restore: status %d, body %s", status, data)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "Plan" {
+		t.Errorf("week after restore = %s, want Plan", got)
+	}
+	restored := c.task(task.ID)
+	if restored.Tags != "work" || !restored.Urgent || restored.Position != task.Position || !restored.CreatedAt.Equal(task.CreatedAt) {
+		t.Errorf("restored task = %+v, want %+v", restored, task)
+	}
+	if _, data := c.call("GET", fmt.Sprintf("/api/tasks/%d/comments", task.ID), ""); !strings.Contains(string(data), "Soon") {
+		t.Errorf("comments after restore = %s", data)
+	}
+
+	newer := strings.Replace(string(backup), fmt.Sprintf(`"schemaVersion":%d`, schemaVersion), `"schemaVersion":99`, 1)
+	if status, _ := admin("POST", "/api/admin/restore", newer); status != http.StatusBadRequest {
+		t.Errorf("restore of a newer snapshot: status %d, want 400", status)
+	}
+
+	savedMax := config.Backup.MaxRestoreBytes
+	config.Backup.MaxRestoreBytes = 64
+	t.Cleanup(func() { config.Backup.MaxRestoreBytes = savedMax })
+	if status, _ := admin("POST", "/api/admin/restore", string(backup)); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("restore over the size limit: status %d, want 413", status)
+	}
+}
+
+func TestAdminEndpointsRequireToken(t *testing.T) {
+	c := newTestClient(t)
+	c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+
+	// Without a configured token the endpoints are off, whatever is sent.
+	saved := config.AdminToken
+	config.AdminToken = ""
+	t.Cleanup(func() { config.AdminToken = saved })
+	for _, token := range []string{"", "Bearer ", "Bearer guess"} {
+		if status, data := c.call("GET", "/api/admin/backup", "", "Authorization", token); status != http.StatusForbidden || !strings.Contains(string(data), codeAdminDisabled) {
+			t.Errorf("backup with %q: status %d, body %s", token, status, data)
+		}
+		if status, _ := c.call("POST", "/api/admin/restore", `{"version":1,"schemaVersion":0,"tables":{}}`, "Authorization", token); status != http.StatusForbidden {
+			t.Errorf("restore with %q: status %d, want 403", token, status)
+		}
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "Plan" {
+		t.Errorf("week after rejected restore = %s, want Plan", got)
+	}
+
+	config.AdminToken = "secret"
+	if status, _ := c.call("GET", "/api/admin/backup", "", "Authorization", "Bearer guess"); status != http.StatusUnauthorized {
+		t.Errorf("backup with a wrong token: status %d, want 401", status)
+	}
+	if status, _ := c.call("GET", "/api/admin/backup", "", "Authorization", "Bearer secret"); status != http.StatusOK {
+		t.Errorf("backup with the token: status %d, want 200", status)
+	}
+}
+
+func TestSnapshotUpgrades(t *testing.T) {
+	c := newTestClient(t)
+
+	// Snapshots from before schema versioning have neither week dates nor
+	// tags, and none of the later columns.
+	snapshot, err := decodeSnapshot(strings.NewReader(`{
+		"version": 1,
+		"schemaVersion": 0,
+		"createdAt": "2023-06-01T12:00:00Z",
+		"tables": {"tasks": [
+			{"id": 1, "title": "First", "completed": false, "day_of_week": "monday", "created_at": "2023-06-01T09:00:00Z", "updated_at": "2023-06-01T09:00:00Z"},
+			{"id": 2, "title": "Second", "completed": true, "day_of_week": "monday", "created_at": "2023-06-01T10:00:00Z", "updated_at": "2023-06-01T10:00:00Z"}
+		]}
+	}`))
+	if err != nil {
+		t.Fatalf("decodeSnapshot: %v", err)
+	}
+	if snapshot.SchemaVersion != schemaVersion {
+		t.Errorf("upgraded schema version = %d, want %d", snapshot.SchemaVersion, schemaVersion)
+	}
+	if _, err := restoreSnapshot(snapshot); err != nil {
+		t.Fatalf("restoreSnapshot: %v", err)
+	}
+
+	week := getWeekStart(time.Now().In(timezone)).Format("2006-01-02")
+	if got := c.titles("/api/tasks/week/" + week); got != "First,Second" {
+		t.Errorf("current week after restore = %s, want First,Second", got)
+	}
+	first, second := c.task(1), c.task(2)
+	if first.Tags != "" || first.Position == "" || first.Position >= second.Position {
+		t.Errorf("upgraded tasks = %+v, %+v", first, second)
+	}
+
+	for _, body := range []string{
+		`{"version": 2, "schemaVersion": 0, "tables": {}}`,
+		`{"version": 1, "schemaVersion": 0, "tables": {"accounts": []}}`,
+		`{"version": 1, "schemaVersion": 0}`,
+	} {
+		if _, err := decodeSnapshot(strings.NewReader(body)); err == nil {
+			t.Errorf("decodeSnapshot(%s) succeeded, want an error", body)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Bulk modes. In atomic mode the first failing operation rolls back the whole
+// request; in best-effort mode failing operations are skipped and the rest
+// are committed.
+const (
+	bulkAtomic     = "atomic"
+	bulkBestEffort = "bestEffort"
+)
+
+// BulkRequest is the body of POST /api/tasks/bulk.
+type BulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []BulkOperation `json:"operations"`
+}
+
+// BulkOperation is one change in a bulk request. Op is one of create,
+// update, delete, complete or move; the other fields depend on it.
+type BulkOperation struct {
+	Op        string             `json:"op"`
+	ID        int                `json:"id,omitempty"`
+	Task      *UpdateTaskRequest `json:"task,omitempty"`      // create, update
+	Completed *bool              `json:"completed,omitempty"` // complete; defaults to true
+	DayOfWeek string             `json:"dayOfWeek,omitempty"` // move
+	WeekDate  string             `json:"weekDate,omitempty"`  // move
+	Relative  string             `json:"relative,omitempty"`  // move
+}
+
+// BulkResult reports the outcome of one operation. Status is the HTTP status
+// the operation would have had as a single request.
+type BulkResult struct {
+	Index  int        `json:"index"`
+	Op     string     `json:"op"`
+	ID     int        `json:"id,omitempty"`
+	Status int        `json:"status"`
+	Task   *Task      `json:"task,omitempty"`
+	Error  *BulkError `json:"error,omitempty"`
+}
+
+// BulkError describes why an operation failed, using the problem codes.
+type BulkError struct {
+	Code   string       `json:"code"`
+	Detail string       `json:"detail"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// BulkResponse is returned when a bulk request was committed.
+type BulkResponse struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// bulkProblem is the problem returned when an atomic bulk request is rolled
+// back. Results ends with the operation that failed.
+type bulkProblem struct {
+	Problem
+	Results []BulkResult `json:"results"`
+}
+
+func (res *BulkResult) fail(status int, code, detail string, fieldErrors ...FieldError) {
+	res.Status = status
+	res.Error = &BulkError{Code: code, Detail: detail, Errors: fieldErrors}
+}
+
+func (res *BulkResult) invalid(fieldErrors ...FieldError) {
+	res.fail(http.StatusUnprocessableEntity, codeValidationFailed, "The operation contains invalid fields", fieldErrors...)
+}
+
+// prefixFields qualifies field errors with the name of the enclosing object.
+func prefixFields(prefix string, fieldErrors []FieldError) []FieldError {
+	for i := range fieldErrors {
+		fieldErrors[i].Field = prefix + "." + fieldErrors[i].Field
+	}
+	return fieldErrors
+}
+
+// validateBulkTask checks the task of a create or update operation.
+func validateBulkTask(ctx context.Context, q queryer, fields *taskFields) ([]FieldError, error) {
+	fieldErrors := fields.validate()
+	projectErrors, err := checkProject(ctx, q, fields.ProjectID)
+	return append(fieldErrors, projectErrors...), err
+}
+
+// applyBulkOperation runs one operation. Problems with the operation itself
+// are reported in the result; the error is only set for database failures.
+func applyBulkOperation(ctx context.Context, q queryer, op BulkOperation) (BulkResult, error) {
+	res := BulkResult{Op: op.Op, ID: op.ID, Status: http.StatusOK}
+
+	if op.Op != "create" && op.ID <= 0 {
+		res.invalid(FieldError{Field: "id", Code: fieldRequired, Message: "is required"})
+		return res, nil
+	}
+	if (op.Op == "create" || op.Op == "update") && op.Task == nil {
+		res.invalid(FieldError{Field: "task", Code: fieldRequired, Message: "is required"})
+		return res, nil
+	}
+
+	var task Task
+	var err error
+	switch op.Op {
+	case "create":
+		fields := taskFields{Title: op.Task.Title, Description: op.Task.Description, DayOfWeek: op.Task.DayOfWeek, WeekDate: op.Task.WeekDate, Tags: op.Task.Tags, Urgent: op.Task.Urgent, Important: op.Task.Important, ProjectID: op.Task.ProjectID}
+		var fieldErrors []FieldError
+		fieldErrors, err = validateBulkTask(ctx, q, &fields)
+		if err != nil {
+			return res, err
+		}
+		if len(fieldErrors) > 0 {
+			res.invalid(prefixFields("task", fieldErrors)...)
+			return res, nil
+		}
+		task, err = insertTask(ctx, q, fields)
+		res.Status = http.StatusCreated
+
+	case "update":
+		fields := taskFields{Title: op.Task.Title, Description: op.Task.Description, DayOfWeek: op.Task.DayOfWeek, WeekDate: op.Task.WeekDate, Tags: op.Task.Tags, Urgent: op.Task.Urgent, Important: op.Task.Important, ProjectID: op.Task.ProjectID}
+		var fieldErrors []FieldError
+		fieldErrors, err = validateBulkTask(ctx, q, &fields)
+		if err != nil {
+			return res, err
+		}
+		if len(fieldErrors) > 0 {
+			res.invalid(prefixFields("task", fieldErrors)...)
+			return res, nil
+		}
+		task, err = saveTask(ctx, q, op.ID, fields, op.Task.Completed)
+
+	case "delete":
+		err = removeTask(ctx, q, op.ID)
+
+	case "complete":
+		completed := true
+		if op.Completed != nil {
+			completed = *op.Completed
+		}
+		task, err = setTaskCompleted(ctx, q, op.ID, completed)
+
+	case "move":
+		var fieldErrors []FieldError
+		task, fieldErrors, err = moveTaskTo(ctx, q, op.ID, taskTarget{DayOfWeek: op.DayOfWeek, WeekDate: op.WeekDate, Relative: op.Relative})
+		if len(fieldErrors) > 0 {
+			res.invalid(fieldErrors...)
+			return res, nil
+		}
+
+	default:
+		res.invalid(FieldError{Field: "op", Code: fieldInvalid, Message: "must be create, update, delete, complete or move"})
+		return res, nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		res.fail(http.StatusNotFound, codeTaskNotFound, "Task not found")
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	if op.Op != "delete" {
+		res.ID = task.ID
+		res.Task = &task
+	}
+	return res, nil
+}
+
+func bulkTasks(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = bulkAtomic
+	}
+	var fieldErrors []FieldError
+	if req.Mode != bulkAtomic && req.Mode != bulkBestEffort {
+		fieldErrors = append(fieldErrors, FieldError{Field: "mode", Code: fieldInvalid, Message: "must be atomic or bestEffort"})
+	}
+	switch {
+	case len(req.Operations) == 0:
+		fieldErrors = append(fieldErrors, FieldError{Field: "operations", Code: fieldRequired, Message: "must contain at least one operation"})
+	case len(req.Operations) > config.Limits.MaxBulkOperations:
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "operations",
+			Code:    fieldTooMany,
+			Message: fmt.Sprintf("must have at most %d operations, got %d", config.Limits.MaxBulkOperations, len(req.Operations)),
+		})
+	}
+	if len(fieldErrors) > 0 {
+		logger.Warn("Invalid bulk request", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	response := BulkResponse{Mode: req.Mode, Results: make([]BulkResult, 0, len(req.Operations))}
+	for i, op := range req.Operations {
+		// A savepoint lets a failed operation be undone without losing the
+		// others in best-effort mode.
+		if _, err := tx.ExecContext(r.Context(), "SAVEPOINT bulk_operation"); err != nil {
+			logger.Error("Failed to create savepoint", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+
+		res, err := applyBulkOperation(r.Context(), tx, op)
+		if err != nil {
+			logger.Error("Bulk operation failed", "index", i, "op", op.Op, "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		res.Index = i
+		response.Results = append(response.Results, res)
+
+		if res.Error != nil {
+			response.Failed++
+			if req.Mode == bulkAtomic {
+				logger.Warn("Bulk request rolled back", "index", i, "op", op.Op, "code", res.Error.Code)
+				writeProblemBody(w, http.StatusUnprocessableEntity, bulkProblem{
+					Problem: newProblem(r, http.StatusUnprocessableEntity, codeBulkFailed,
+						fmt.Sprintf("Operation %d failed, no changes were applied", i)),
+					Results: response.Results,
+				})
+				return
+			}
+			_, err = tx.ExecContext(r.Context(), "ROLLBACK TO bulk_operation")
+		} else {
+			response.Succeeded++
+		}
+		if err == nil {
+			_, err = tx.ExecContext(r.Context(), "RELEASE bulk_operation")
+		}
+		if err != nil {
+			logger.Error("Failed to release savepoint", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit bulk request", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Bulk request applied", "mode", req.Mode, "succeeded", response.Succeeded, "failed", response.Failed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// completeWeek marks every task of a week as completed.
+func completeWeek(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	weekDate, ok := normalizeWeekDate(r.PathValue("weekDate"))
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid path parameter",
+			FieldError{Field: "weekDate", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+		return
+	}
+
+	updated, err := completeWeekTasks(r.Context(), weekDate)
+	if err != nil {
+		logger.Error("Database update failed", "week", weekDate, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Week completed", "week", weekDate, "updated", updated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"weekDate": weekDate, "updated": updated})
+}
+
+// completeWeekTasks completes the open tasks of a week one by one, so each
+// change is recorded.
+func completeWeekTasks(ctx context.Context, weekDate string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM tasks WHERE week_date = ? AND NOT completed AND deleted_at IS NULL", weekDate)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if _, err := setTaskCompleted(ctx, tx, id, true); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// deleteCompletedTasks moves the completed tasks scheduled before the date
+// given in the before query parameter to the trash.
+func deleteCompletedTasks(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	before, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("before"), timezone)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter",
+			FieldError{Field: "before", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+		return
+	}
+
+	deleted, err := trashCompletedBefore(r.Context(), before)
+	if err != nil {
+		logger.Error("Database delete failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Completed tasks moved to trash", "before", before.Format("2006-01-02"), "deleted", deleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+}
+
+// trashCompletedBefore moves completed tasks whose scheduled date is before
+// the given day to the trash, in one transaction.
+func trashCompletedBefore(ctx context.Context, before time.Time) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Whole weeks are narrowed in SQL; the exact date is checked per task.
+	rows, err := tx.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE completed AND week_date <= ? AND deleted_at IS NULL", before.Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var task Task
+		if err := scanTask(rows, &task); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if date, ok := taskDate(&task); ok && date.Before(before) {
+			ids = append(ids, task.ID)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := removeTask(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBulkModes(t *testing.T) {
+	c := newTestClient(t)
+	c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+
+	operations := `"operations": [
+		{"op": "create", "task": {"title": "Review", "dayOfWeek": "tue", "weekDate": "2024-01-07"}},
+		{"op": "complete", "id": 1},
+		{"op": "update", "id": 99, "task": {"title": "Missing", "dayOfWeek": "wed", "weekDate": "2024-01-07"}},
+		{"op": "move", "id": 1, "dayOfWeek": "fri"}
+	]`
+
+	// An atomic request stops at the first failure and changes nothing.
+	status, data := c.call("POST", "/api/tasks/bulk", `{"mode": "atomic", `+operations+`}`)
+	var problem bulkProblem
+	c.decode(data, &problem)
+	if status != http.StatusUnprocessableEntity || problem.Code != codeBulkFailed || len(problem.Results) != 3 {
+		t.Fatalf("atomic: status %d, body %s", status, data)
+	}
+	if failed := problem.Results[2]; failed.Status != http.StatusNotFound || failed.Error == nil || failed.Error.Code != codeTaskNotFound {
+		t.Errorf("atomic: failed result = %+v", failed)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "Plan" {
+		t.Errorf("week after atomic rollback = %s, want Plan", got)
+	}
+	if task := c.task(1); task.Completed {
+		t.Error("atomic rollback kept the completion")
+	}
+
+	// A best-effort request skips the failure and commits the rest.
+	status, data = c.call("POST", "/api/tasks/bulk", `{"mode": "bestEffort", `+operations+`}`)
+	var response BulkResponse
+	c.decode(data, &response)
+	if status != http.StatusOK || response.Succeeded != 3 || response.Failed != 1 || len(response.Results) != 4 {
+		t.Fatalf("bestEffort: status %d, body %s", status, data)
+	}
+	for i, want := range []int{http.StatusCreated, http.StatusOK, http.StatusNotFound, http.StatusOK} {
+		if res := response.Results[i]; res.Index != i || res.Status != want {
+			t.Errorf("bestEffort: result %d = %+v, want status %d", i, res, want)
+		}
+	}
+	if task := c.task(1); !task.Completed || task.DayOfWeek != "friday" {
+		t.Errorf("bestEffort: task 1 = %+v, want completed on friday", task)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "Plan,Review" {
+		t.Errorf("week after bestEffort = %s, want Plan,Review", got)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"zendo/internal/cli"
+)
+
+func runCLI(t *testing.T, server *httptest.Server, args ...string) string {
+	t.Helper()
+	t.Setenv("ZENDO_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+
+	var stdout, stderr bytes.Buffer
+	args = append(args, "--server", server.URL)
+	if code := cli.Run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("zendoctl %s: exit code %d: %s", strings.Join(args, " "), code, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestCLIAgainstServer(t *testing.T) {
+	server := newTestServer(t)
+
+	var created []Task
+	out := runCLI(t, server, "add", "Write report", "--day", "tue", "--week", "2026-10-14", "--tag", "work", "--tag", "q4", "--json")
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatalf("decoding add output %q: %v", out, err)
+	}
+	if len(created) != 1 {
+		t.Fatalf("got %d created tasks, want 1", len(created))
+	}
+	task := created[0]
+	if task.Title != "Write report" || task.DayOfWeek != "tuesday" || task.WeekDate != "2026-10-11" || task.Tags != "work,q4" {
+		t.Errorf("unexpected created task: %+v", task)
+	}
+
+	runCLI(t, server, "add", "Groceries", "--day", "saturday", "--week", "2026-10-11", "--tag", "home")
+
+	out = runCLI(t, server, "week", "2026-10-11")
+	if !strings.Contains(out, "Write report") || !strings.Contains(out, "Groceries") {
+		t.Errorf("week output missing tasks:\n%s", out)
+	}
+
+	out = runCLI(t, server, "ls", "--week", "2026-10-11", "--tag", "home")
+	if strings.Contains(out, "Write report") || !strings.Contains(out, "Groceries") {
+		t.Errorf("tag filter not applied:\n%s", out)
+	}
+
+	var done []Task
+	out = runCLI(t, server, "done", "--json", "1")
+	if err := json.Unmarshal([]byte(out), &done); err != nil {
+		t.Fatalf("decoding done output %q: %v", out, err)
+	}
+	if len(done) != 1 || !done[0].Completed || done[0].Title != "Write report" {
+		t.Errorf("task not completed: %+v", done)
+	}
+
+	// Tasks keep fields the client does not edit, such as their project.
+	client := &testClient{t: t, server: server}
+	_, data := client.call("POST", "/api/projects", `{"name":"Launch"}`)
+	var project Project
+	client.decode(data, &project)
+	_, data = client.call("POST", "/api/tasks", fmt.Sprintf(`{"title":"Ship","dayOfWeek":"friday","weekDate":"2026-10-11","projectId":%d}`, project.ID))
+	var shipped Task
+	client.decode(data, &shipped)
+	out = runCLI(t, server, "done", "--json", strconv.Itoa(shipped.ID))
+	if err := json.Unmarshal([]byte(out), &done); err != nil {
+		t.Fatalf("decoding done output %q: %v", out, err)
+	}
+	if len(done) != 1 || done[0].ProjectID == nil || *done[0].ProjectID != project.ID {
+		t.Errorf("done dropped the project: %s", out)
+	}
+	runCLI(t, server, "rm", strconv.Itoa(shipped.ID))
+
+	runCLI(t, server, "rm", "2")
+	var remaining []Task
+	out = runCLI(t, server, "ls", "--all", "--json")
+	if err := json.Unmarshal([]byte(out), &remaining); err != nil {
+		t.Fatalf("decoding ls output %q: %v", out, err)
+	}
+	if len(remaining) != 1 || remaining[0].ID != 1 {
+		t.Errorf("unexpected remaining tasks: %+v", remaining)
+	}
+}
+
+func TestCLIAddDefaultsToServerToday(t *testing.T) {
+	server := newTestServer(t)
+	// A timezone far from any test machine, so the server's date differs
+	// from the local one for much of the day.
+	saved := timezone
+	timezone = time.FixedZone("UTC+14", 14*60*60)
+	t.Cleanup(func() { timezone = saved })
+
+	var created []Task
+	out := runCLI(t, server, "add", "Plan", "--json")
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatalf("decoding add output %q: %v", out, err)
+	}
+	today := time.Now().In(timezone)
+	day := strings.ToLower(today.Weekday().String())
+	week := getWeekStart(today).Format("2006-01-02")
+	if len(created) != 1 || created[0].DayOfWeek != day || created[0].WeekDate != week {
+		t.Errorf("created %s, want %s of %s", out, day, week)
+	}
+
+	// A given day still uses the server's week.
+	out = runCLI(t, server, "add", "Review", "--day", "mon", "--json")
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatalf("decoding add output %q: %v", out, err)
+	}
+	if len(created) != 1 || created[0].DayOfWeek != "monday" || created[0].WeekDate != week {
+		t.Errorf("created %s, want monday of %s", out, week)
+	}
+}
+
+func TestServerBinaryTaskCommands(t *testing.T) {
+	server := newTestServer(t)
+	t.Setenv("ZENDO_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+
+	// "zendo add" is the client's add, not a server subcommand.
+	if code := runCommand([]string{"add", "Plan", "--day", "mon", "--week", "2026-10-11", "--server", server.URL, "--json"}); code != 0 {
+		t.Fatalf("zendo add: exit code %d", code)
+	}
+	client := &testClient{t: t, server: server}
+	if got := client.titles("/api/tasks/week/2026-10-11"); got != "Plan" {
+		t.Errorf("week after zendo add = %s, want Plan", got)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := cli.RunAs("zendo", []string{"done", "99", "--server", server.URL}, &stdout, &stderr); code == 0 || !strings.HasPrefix(stderr.String(), "zendo done: ") {
+		t.Errorf("zendo done 99: exit %d, stderr %q", code, stderr.String())
+	}
+}
+
+func TestCLIErrors(t *testing.T) {
+	server := newTestServer(t)
+	t.Setenv("ZENDO_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+
+	for _, args := range [][]string{
+		{"add", "--day", "tue"},
+		{"add", "Task", "--day", "someday"},
+		{"done", "99"},
+		{"week", "not-a-date"},
+		{"bogus"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := cli.Run(append(args, "--server", server.URL), &stdout, &stderr); code == 0 {
+			t.Errorf("zendoctl %s: expected failure, got success", strings.Join(args, " "))
+		}
+	}
+
+	// Completing several tasks is all or nothing, and the error names the
+	// task that failed.
+	client := &testClient{t: t, server: server}
+	client.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2026-10-11"}`)
+	var stdout, stderr bytes.Buffer
+	if code := cli.Run([]string{"done", "1", "99", "--server", server.URL}, &stdout, &stderr); code == 0 || !strings.Contains(stderr.String(), "task 99") {
+		t.Errorf("zendoctl done 1 99: exit %d, stderr %q", code, stderr.String())
+	}
+	if client.task(1).Completed {
+		t.Error("zendoctl done 1 99 completed task 1")
+	}
+}
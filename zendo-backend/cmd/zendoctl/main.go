@@ -0,0 +1,12 @@
+// Command zendoctl is a terminal client for the Zendo task API.
+package main
+
+import (
+	"os"
+
+	"zendo/internal/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
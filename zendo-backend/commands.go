@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"zendo/internal/cli"
+)
+
+// subcommand is a mode of the server binary.
+type subcommand struct {
+	name    string
+	usage   string
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
+}
+
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"serve", "serve [flags]", "Run the HTTP server (default)", runServe},
+		{"migrate", "migrate [flags]", "Apply database migrations and exit", runMigrate},
+		{"backup", "backup [-o FILE] [flags]", "Write a JSON snapshot of the database", runBackup},
+		{"import", "import [flags] FILE", "Replace all data with a JSON snapshot ('-' reads stdin)", runImport},
+		{"repair", "repair [-dry-run] [flags]", "Normalize malformed task rows", runRepair},
+		{"tags-to-projects", "tags-to-projects [TAG...]", "Move tagged tasks into projects named after the tags", runTagsToProjects},
+		{"user", "user [flags] ACTION [NAME]", "Add, list or remove API users, or issue a new token", runUser},
+	}
+}
+
+// runCommand dispatches to a subcommand and returns the process exit code.
+// Without a subcommand the server is started, so existing deployments keep working.
+func runCommand(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printCommandUsage(os.Stdout)
+		return 0
+	}
+	if slices.Contains(cli.TaskCommands, name) {
+		return cli.RunAs("zendo", append([]string{name}, args...), os.Stdout, os.Stderr)
+	}
+
+	for _, cmd := range subcommands {
+		if cmd.name != name {
+			continue
+		}
+		fs := flag.NewFlagSet("zendo "+cmd.name, flag.ContinueOnError)
+		if err := cmd.run(fs, args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			slog.Error("Command failed", "command", cmd.name, "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	printCommandUsage(os.Stderr)
+	return 2
+}
+
+func printCommandUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: zendo [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(w, "  %-26s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Task commands for a running server, as in zendoctl: %s\n", strings.Join(cli.TaskCommands, ", "))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'zendo COMMAND -h' for the flags of a command.")
+}
+
+// setup parses the common flags, loads the effective configuration and
+// applies it. It returns the remaining positional arguments.
+func setup(fs *flag.FlagSet, args []string) ([]string, error) {
+	var flags configFlags
+	flags.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return nil, err
+	}
+	config = cfg
+	if err := setupLogging(os.Stderr, config.LogLevel, config.LogFormat); err != nil {
+		return nil, err
+	}
+	setTimezone(config.Timezone)
+
+	return fs.Args(), nil
+}
+
+func runServe(fs *flag.FlagSet, args []string) error {
+	if _, err := setup(fs, args); err != nil {
+		return err
+	}
+	return serve()
+}
+
+func runMigrate(fs *flag.FlagSet, args []string) error {
+	if _, err := setup(fs, args); err != nil {
+		return err
+	}
+
+	if err := openDatabase(config.Database); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	slog.Info("Database migrated", "database", config.Database, "schema_version", schemaVersion)
+	return nil
+}
+
+func runBackup(fs *flag.FlagSet, args []string) error {
+	output := fs.String("o", "", "write the snapshot to FILE instead of the backup directory ('-' for stdout)")
+	if _, err := setup(fs, args); err != nil {
+		return err
+	}
+
+	if err := openDatabase(config.Database); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *output == "" {
+		path, err := writeBackupFile(config.Backup.Dir)
+		if err != nil {
+			return err
+		}
+		slog.Info("Backup written", "path", path)
+		return pruneBackups(config.Backup.Dir, config.Backup.Keep)
+	}
+
+	snapshot, err := createSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		return json.NewEncoder(os.Stdout).Encode(snapshot)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(snapshot); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	slog.Info("Backup written", "path", *output)
+	return nil
+}
+
+func runImport(fs *flag.FlagSet, args []string) error {
+	positional, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("exactly one snapshot file is required")
+	}
+
+	var input io.Reader = os.Stdin
+	if positional[0] != "-" {
+		file, err := os.Open(positional[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	snapshot, err := decodeSnapshot(input)
+	if err != nil {
+		return err
+	}
+
+	if err := openDatabase(config.Database); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = restoreSnapshot(snapshot)
+	return err
+}
+
+func runRepair(fs *flag.FlagSet, args []string) error {
+	dryRun := fs.Bool("dry-run", false, "report the changes without writing them")
+	if _, err := setup(fs, args); err != nil {
+		return err
+	}
+
+	if err := openDatabase(config.Database); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repaired, unrepairable, err := repairTasks(*dryRun)
+	if err != nil {
+		return err
+	}
+	slog.Info("Repair finished", "repaired", repaired, "unrepairable", unrepairable, "dry_run", *dryRun)
+	if unrepairable > 0 {
+		return fmt.Errorf("%d tasks need manual repair", unrepairable)
+	}
+	return nil
+}
+
+func runTagsToProjects(fs *flag.FlagSet, args []string) error {
+	dryRun := fs.Bool("dry-run", false, "report the changes without writing them")
+	keepTags := fs.Bool("keep-tags", false, "keep the migrated tag on each task")
+	tags, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := openDatabase(config.Database); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := withAudit(context.Background(), auditInfo{Source: "cli"})
+	created, moved, err := projectsFromTags(ctx, tags, *keepTags, *dryRun)
+	if err != nil {
+		return err
+	}
+	slog.Info("Tags migrated to projects", "projects_created", created, "tasks_moved", moved, "dry_run", *dryRun)
+	return nil
+}
+
+func runUser(fs *flag.FlagSet, args []string) error {
+	positional, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return errors.New("an action is required: add NAME, list, remove NAME or token NAME")
+	}
+	action, names := positional[0], positional[1:]
+	if action == "list" && len(names) != 0 || action != "list" && len(names) != 1 {
+		return errors.New("usage: zendo user add NAME, list, remove NAME or token NAME")
+	}
+
+	if err := openDatabase(config.Database); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch action {
+	case "add", "token":
+		add := action == "add"
+		var token string
+		if add {
+			token, err = addUser(ctx, names[0])
+		} else {
+			token, err = resetUserToken(ctx, names[0])
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("User token issued", "user", names[0], "new_user", add)
+		// The token is printed on its own so it can be captured by scripts.
+		fmt.Println(token)
+		return nil
+	case "remove":
+		if err := removeUser(ctx, names[0]); err != nil {
+			return err
+		}
+		slog.Info("User removed", "user", names[0])
+		return nil
+	case "list":
+		users, err := listUsers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			fmt.Printf("%s\t%s\n", user.Name, user.CreatedAt.In(timezone).Format("2006-01-02 15:04"))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comment is a note on a task by one of the people sharing the server.
+type Comment struct {
+	ID        int       `json:"id"`
+	TaskID    int       `json:"taskId"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`               // Markdown
+	BodyHTML  string    `json:"bodyHtml,omitempty"` // with ?render=html
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CommentRequest is the body of POST and PUT /api/tasks/{id}/comments. An
+// update without an author keeps the current one.
+type CommentRequest struct {
+	Author string `json:"author"`
+	Body   string `json:"body"` // Markdown
+}
+
+const commentColumns = "id, task_id, author, body, created_at, updated_at"
+
+func scanComment(row rowScanner, c *Comment) error {
+	return row.Scan(&c.ID, &c.TaskID, &c.Author, &c.Body, &c.CreatedAt, &c.UpdatedAt)
+}
+
+// loadComment returns sql.ErrNoRows unless the comment belongs to the task.
+func loadComment(ctx context.Context, q queryer, taskID, id int) (Comment, error) {
+	var c Comment
+	err := scanComment(q.QueryRowContext(ctx, "SELECT "+commentColumns+" FROM comments WHERE id = ? AND task_id = ?", id, taskID), &c)
+	return c, err
+}
+
+func queryComments(ctx context.Context, q queryer, taskID int) ([]Comment, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+commentColumns+" FROM comments WHERE task_id = ? ORDER BY id", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := scanComment(rows, &c); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// renderComments fills in BodyHTML when the client asked for it.
+func renderComments(r *http.Request, comments []Comment) error {
+	if !wantsHTML(r) {
+		return nil
+	}
+	for i := range comments {
+		html, err := renderMarkdown(comments[i].Body)
+		if err != nil {
+			return err
+		}
+		comments[i].BodyHTML = html
+	}
+	return nil
+}
+
+// validate normalizes the request and checks it against the configured
+// limits. The author is only required when creating a comment.
+func (c *CommentRequest) validate(creating bool) []FieldError {
+	var fieldErrors []FieldError
+	c.Author = strings.TrimSpace(c.Author)
+	if creating && c.Author == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "author", Code: fieldRequired, Message: "is required"})
+	}
+	c.Body = normalizeDescription(c.Body)
+	if strings.TrimSpace(c.Body) == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "body", Code: fieldRequired, Message: "is required"})
+	}
+	return append(fieldErrors, validateCommentLimits(c.Author, c.Body)...)
+}
+
+// pathComment loads the comment named by the path, writing the problem
+// response when it does not exist.
+func pathComment(w http.ResponseWriter, r *http.Request) (Comment, bool) {
+	logger := requestLogger(r)
+
+	taskID, ok := pathTask(w, r)
+	if !ok {
+		return Comment{}, false
+	}
+
+	idStr := r.PathValue("commentId")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid comment ID", "id", idStr, "error", err)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidID, "Comment ID must be an integer")
+		return Comment{}, false
+	}
+
+	comment, err := loadComment(r.Context(), db, taskID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Comment not found", "task_id", taskID, "comment_id", id)
+		writeProblem(w, r, http.StatusNotFound, codeCommentNotFound, "Comment not found")
+		return Comment{}, false
+	}
+	if err != nil {
+		logger.Error("Database query failed", "comment_id", id, "error", err)
+		writeInternalError(w, r)
+		return Comment{}, false
+	}
+	return comment, true
+}
+
+// writeComment sends a comment, rendered when the client asked for it.
+func writeComment(w http.ResponseWriter, r *http.Request, status int, comment Comment) {
+	comments := []Comment{comment}
+	if err := renderComments(r, comments); err != nil {
+		requestLogger(r).Error("Rendering comment failed", "comment_id", comment.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(comments[0])
+}
+
+func listComments(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	taskID, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := queryComments(r.Context(), db, taskID)
+	if err == nil {
+		err = renderComments(r, comments)
+	}
+	if err != nil {
+		logger.Error("Failed to load comments", "task_id", taskID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+func createComment(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	taskID, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	if fieldErrors := req.validate(true); len(fieldErrors) > 0 {
+		logger.Warn("Comment validation failed", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	result, err := db.ExecContext(r.Context(), "INSERT INTO comments (task_id, author, body) VALUES (?, ?, ?)", taskID, req.Author, req.Body)
+	if err != nil {
+		logger.Error("Database insert failed", "task_id", taskID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		logger.Error("Failed to get comment ID", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	comment, err := loadComment(r.Context(), db, taskID, int(id))
+	if err != nil {
+		logger.Error("Database query failed", "comment_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Comment created", "task_id", taskID, "comment_id", comment.ID)
+	logger.Debug("Comment details", "comment", comment)
+
+	writeComment(w, r, http.StatusCreated, comment)
+}
+
+func updateComment(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	comment, ok := pathComment(w, r)
+	if !ok {
+		return
+	}
+
+	var req CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	if fieldErrors := req.validate(false); len(fieldErrors) > 0 {
+		logger.Warn("Comment validation failed", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+	if req.Author == "" {
+		req.Author = comment.Author
+	}
+
+	_, err := db.ExecContext(r.Context(), "UPDATE comments SET author = ?, body = ?, updated_at = "+nowMillis+" WHERE id = ?",
+		req.Author, req.Body, comment.ID)
+	if err == nil {
+		comment, err = loadComment(r.Context(), db, comment.TaskID, comment.ID)
+	}
+	if err != nil {
+		logger.Error("Database update failed", "comment_id", comment.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Comment updated", "task_id", comment.TaskID, "comment_id", comment.ID)
+
+	writeComment(w, r, http.StatusOK, comment)
+}
+
+func deleteComment(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	comment, ok := pathComment(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := db.ExecContext(r.Context(), "DELETE FROM comments WHERE id = ?", comment.ID); err != nil {
+		logger.Error("Database delete failed", "comment_id", comment.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Comment deleted", "task_id", comment.TaskID, "comment_id", comment.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted successfully"})
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the server settings. Values are resolved in order from the
+// defaults, the YAML config file, ZENDO_* environment variables and finally
+// command-line flags.
+type Config struct {
+	Listen         string            `yaml:"listen"`
+	MetricsListen  string            `yaml:"metrics_listen"`
+	HealthListen   string            `yaml:"health_listen"`
+	Database       string            `yaml:"database"`
+	AllowedOrigins []string          `yaml:"allowed_origins"`
+	LogLevel       string            `yaml:"log_level"`
+	LogFormat      string            `yaml:"log_format"`
+	Timezone       string            `yaml:"timezone"`
+	AdminToken     string            `yaml:"admin_token"`
+	Backup         BackupConfig      `yaml:"backup"`
+	Attachments    AttachmentsConfig `yaml:"attachments"`
+	Trash          TrashConfig       `yaml:"trash"`
+	TLS            TLSConfig         `yaml:"tls"`
+	Limits         LimitsConfig      `yaml:"limits"`
+}
+
+// BackupConfig controls scheduled backups. An empty interval disables them.
+type BackupConfig struct {
+	Interval string `yaml:"interval"`
+	Dir      string `yaml:"dir"`
+	Keep     int    `yaml:"keep"`
+	// MaxRestoreBytes caps the size of a snapshot uploaded for restore.
+	MaxRestoreBytes int64 `yaml:"max_restore_bytes"`
+}
+
+// AttachmentsConfig controls where task attachments are stored and how much
+// space they may take.
+type AttachmentsConfig struct {
+	Dir          string `yaml:"dir"`
+	MaxFileBytes int64  `yaml:"max_file_bytes"`
+	// MaxTaskBytes caps the attachments of one task and QuotaBytes the
+	// stored files of the whole server. Zero means no limit.
+	MaxTaskBytes int64 `yaml:"max_task_bytes"`
+	QuotaBytes   int64 `yaml:"quota_bytes"`
+}
+
+// TrashConfig controls how long deleted tasks can be restored. An empty
+// retention keeps them until they are restored.
+type TrashConfig struct {
+	Retention string `yaml:"retention"`
+}
+
+// TLSConfig enables HTTPS on the main listener, either from certificate and
+// key files or with certificates obtained automatically over ACME.
+type TLSConfig struct {
+	CertFile string     `yaml:"cert_file"`
+	KeyFile  string     `yaml:"key_file"`
+	ACME     ACMEConfig `yaml:"acme"`
+	// RedirectListen serves HTTP to HTTPS redirects, and ACME HTTP-01
+	// challenges, on a second address such as ":80".
+	RedirectListen string `yaml:"redirect_listen"`
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds.
+	// Zero disables the header.
+	HSTSMaxAge int `yaml:"hsts_max_age"`
+}
+
+// ACMEConfig controls automatic certificates. Listing domains enables it.
+type ACMEConfig struct {
+	Domains []string `yaml:"domains"`
+	Email   string   `yaml:"email"`
+	// DirectoryURL defaults to Let's Encrypt. Point it at another CA, or at
+	// a local Pebble server for testing.
+	DirectoryURL string `yaml:"directory_url"`
+	// CAFile is a PEM bundle trusted when talking to the ACME directory,
+	// needed for test CAs such as Pebble.
+	CAFile   string `yaml:"ca_file"`
+	CacheDir string `yaml:"cache_dir"`
+}
+
+// enabled reports whether the main listener serves HTTPS.
+func (c TLSConfig) enabled() bool {
+	return c.CertFile != "" || len(c.ACME.Domains) > 0
+}
+
+// LimitsConfig protects the API from runaway clients.
+type LimitsConfig struct {
+	// RequestsPerSecond and Burst size the per-client token bucket.
+	// A zero rate disables rate limiting.
+	RequestsPerSecond    float64 `yaml:"requests_per_second"`
+	Burst                int     `yaml:"burst"`
+	MaxBodyBytes         int64   `yaml:"max_body_bytes"`
+	MaxTitleLength       int     `yaml:"max_title_length"`
+	MaxDescriptionLength int     `yaml:"max_description_length"`
+	MaxCommentLength     int     `yaml:"max_comment_length"`
+	MaxTags              int     `yaml:"max_tags"`
+	MaxBulkOperations    int     `yaml:"max_bulk_operations"`
+}
+
+// defaultConfigPath is read when no config file is given explicitly.
+const defaultConfigPath = "./storage/zendo.yaml"
+
+var config = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Listen:         ":8080",
+		Database:       "./storage/zendo.db",
+		AllowedOrigins: []string{"http://localhost:5173", "http://localhost:5174", "http://localhost:8080"},
+		LogLevel:       "info",
+		LogFormat:      "text",
+		Timezone:       "America/Los_Angeles",
+		Backup: BackupConfig{
+			Dir:             "./storage/backups",
+			Keep:            7,
+			MaxRestoreBytes: 256 << 20,
+		},
+		Attachments: AttachmentsConfig{
+			Dir:          "./storage/attachments",
+			MaxFileBytes: 25 << 20,
+			MaxTaskBytes: 100 << 20,
+			QuotaBytes:   1 << 30,
+		},
+		Trash: TrashConfig{
+			Retention: "720h",
+		},
+		TLS: TLSConfig{
+			HSTSMaxAge: 365 * 24 * 60 * 60,
+			ACME: ACMEConfig{
+				CacheDir: "./storage/certs",
+			},
+		},
+		Limits: LimitsConfig{
+			RequestsPerSecond:    10,
+			Burst:                40,
+			MaxBodyBytes:         1 << 20,
+			MaxTitleLength:       500,
+			MaxDescriptionLength: 20000,
+			MaxCommentLength:     10000,
+			MaxTags:              20,
+			MaxBulkOperations:    500,
+		},
+	}
+}
+
+// configFlags holds the flag values that override the config file.
+type configFlags struct {
+	path           string
+	listen         string
+	metricsListen  string
+	healthListen   string
+	database       string
+	allowedOrigins string
+	logLevel       string
+	logFormat      string
+	timezone       string
+	tlsCert        string
+	tlsKey         string
+}
+
+// register adds the configuration flags shared by every subcommand.
+func (f *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.path, "config", "", "path to the YAML config file (default "+defaultConfigPath+")")
+	fs.StringVar(&f.listen, "listen", "", "address to listen on")
+	fs.StringVar(&f.metricsListen, "metrics-listen", "", "serve /metrics on this separate address instead of the main listener")
+	fs.StringVar(&f.healthListen, "health-listen", "", "also serve /healthz and /readyz over plain HTTP on this address")
+	fs.StringVar(&f.database, "db", "", "path to the SQLite database")
+	fs.StringVar(&f.allowedOrigins, "origins", "", "comma-separated list of allowed CORS origins")
+	fs.StringVar(&f.logLevel, "log-level", "", "log level: debug, info, warn or error")
+	fs.StringVar(&f.logFormat, "log-format", "", "log output format: text or json")
+	fs.StringVar(&f.timezone, "timezone", "", "IANA timezone used to determine today's date")
+	fs.StringVar(&f.tlsCert, "tls-cert", "", "serve HTTPS using this PEM certificate file")
+	fs.StringVar(&f.tlsKey, "tls-key", "", "PEM private key file for --tls-cert")
+}
+
+// loadConfig resolves the effective configuration.
+func loadConfig(flags configFlags) (Config, error) {
+	cfg := defaultConfig()
+
+	path := flags.path
+	if path == "" {
+		path = os.Getenv("ZENDO_SERVER_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath
+	}
+
+	// The timezone is left empty until the file and environment have been
+	// read, so applyEnv can tell whether either of them set one.
+	defaultTimezone := cfg.Timezone
+	cfg.Timezone = ""
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// The default config file is optional.
+	default:
+		return cfg, err
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Timezone == "" {
+		cfg.Timezone = defaultTimezone
+	}
+
+	if flags.listen != "" {
+		cfg.Listen = flags.listen
+	}
+	if flags.metricsListen != "" {
+		cfg.MetricsListen = flags.metricsListen
+	}
+	if flags.healthListen != "" {
+		cfg.HealthListen = flags.healthListen
+	}
+	if flags.database != "" {
+		cfg.Database = flags.database
+	}
+	if flags.allowedOrigins != "" {
+		cfg.AllowedOrigins = splitList(flags.allowedOrigins)
+	}
+	if flags.logLevel != "" {
+		cfg.LogLevel = flags.logLevel
+	}
+	if flags.logFormat != "" {
+		cfg.LogFormat = flags.logFormat
+	}
+	if flags.timezone != "" {
+		cfg.Timezone = flags.timezone
+	}
+	if flags.tlsCert != "" {
+		cfg.TLS.CertFile = flags.tlsCert
+	}
+	if flags.tlsKey != "" {
+		cfg.TLS.KeyFile = flags.tlsKey
+	}
+
+	return cfg, cfg.validate()
+}
+
+// applyEnv overrides cfg with any ZENDO_* environment variables. The older
+// APP_URL variable is still honoured, and so is TZ, but only for a config
+// whose timezone is still empty. Numbers that do not parse are an error
+// naming the variable.
+func applyEnv(cfg *Config) error {
+	if v := os.Getenv("ZENDO_LISTEN"); v != "" {
+		cfg.Listen = v
+	}
+	if v := os.Getenv("ZENDO_METRICS_LISTEN"); v != "" {
+		cfg.MetricsListen = v
+	}
+	if v := os.Getenv("ZENDO_HEALTH_LISTEN"); v != "" {
+		cfg.HealthListen = v
+	}
+	if v := os.Getenv("ZENDO_DATABASE"); v != "" {
+		cfg.Database = v
+	}
+	if v := os.Getenv("ZENDO_ALLOWED_ORIGINS"); v != "" {
+		cfg.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("APP_URL"); v != "" {
+		cfg.AllowedOrigins = append(cfg.AllowedOrigins, v)
+	}
+	if v := os.Getenv("ZENDO_LOG_LEVEL"); v != "" {
+		cfg.LogLevel = v
+	}
+	if v := os.Getenv("ZENDO_LOG_FORMAT"); v != "" {
+		cfg.LogFormat = v
+	}
+	if v := os.Getenv("ZENDO_TIMEZONE"); v != "" {
+		cfg.Timezone = v
+	}
+	if cfg.Timezone == "" {
+		cfg.Timezone = os.Getenv("TZ")
+	}
+	if v := os.Getenv("ZENDO_ADMIN_TOKEN"); v != "" {
+		cfg.AdminToken = v
+	}
+	if v := os.Getenv("ZENDO_BACKUP_INTERVAL"); v != "" {
+		cfg.Backup.Interval = v
+	}
+	if v := os.Getenv("ZENDO_BACKUP_DIR"); v != "" {
+		cfg.Backup.Dir = v
+	}
+	if v := os.Getenv("ZENDO_ATTACHMENTS_DIR"); v != "" {
+		cfg.Attachments.Dir = v
+	}
+	if v := os.Getenv("ZENDO_TRASH_RETENTION"); v != "" {
+		cfg.Trash.Retention = v
+	}
+	if v := os.Getenv("ZENDO_TLS_CERT_FILE"); v != "" {
+		cfg.TLS.CertFile = v
+	}
+	if v := os.Getenv("ZENDO_TLS_KEY_FILE"); v != "" {
+		cfg.TLS.KeyFile = v
+	}
+	if v := os.Getenv("ZENDO_TLS_REDIRECT_LISTEN"); v != "" {
+		cfg.TLS.RedirectListen = v
+	}
+	if v := os.Getenv("ZENDO_ACME_DOMAINS"); v != "" {
+		cfg.TLS.ACME.Domains = splitList(v)
+	}
+	if v := os.Getenv("ZENDO_ACME_EMAIL"); v != "" {
+		cfg.TLS.ACME.Email = v
+	}
+	if v := os.Getenv("ZENDO_ACME_DIRECTORY_URL"); v != "" {
+		cfg.TLS.ACME.DirectoryURL = v
+	}
+	if v := os.Getenv("ZENDO_ACME_CA_FILE"); v != "" {
+		cfg.TLS.ACME.CAFile = v
+	}
+	if v := os.Getenv("ZENDO_ACME_CACHE_DIR"); v != "" {
+		cfg.TLS.ACME.CacheDir = v
+	}
+	return errors.Join(
+		envInt("ZENDO_BACKUP_KEEP", &cfg.Backup.Keep),
+		envInt64("ZENDO_MAX_RESTORE_BYTES", &cfg.Backup.MaxRestoreBytes),
+		envInt64("ZENDO_MAX_ATTACHMENT_BYTES", &cfg.Attachments.MaxFileBytes),
+		envInt64("ZENDO_MAX_TASK_ATTACHMENT_BYTES", &cfg.Attachments.MaxTaskBytes),
+		envInt64("ZENDO_ATTACHMENT_QUOTA_BYTES", &cfg.Attachments.QuotaBytes),
+		envInt("ZENDO_TLS_HSTS_MAX_AGE", &cfg.TLS.HSTSMaxAge),
+		envFloat("ZENDO_RATE_LIMIT", &cfg.Limits.RequestsPerSecond),
+		envInt("ZENDO_RATE_LIMIT_BURST", &cfg.Limits.Burst),
+		envInt64("ZENDO_MAX_BODY_BYTES", &cfg.Limits.MaxBodyBytes),
+		envInt("ZENDO_MAX_TITLE_LENGTH", &cfg.Limits.MaxTitleLength),
+		envInt("ZENDO_MAX_DESCRIPTION_LENGTH", &cfg.Limits.MaxDescriptionLength),
+		envInt("ZENDO_MAX_COMMENT_LENGTH", &cfg.Limits.MaxCommentLength),
+		envInt("ZENDO_MAX_TAGS", &cfg.Limits.MaxTags),
+		envInt("ZENDO_MAX_BULK_OPERATIONS", &cfg.Limits.MaxBulkOperations),
+	)
+}
+
+// envInt sets *dst from the named environment variable, if it is set.
+func envInt(name string, dst *int) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: not an integer", name, v)
+	}
+	*dst = n
+	return nil
+}
+
+// envInt64 is envInt for 64-bit sizes.
+func envInt64(name string, dst *int64) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: not an integer", name, v)
+	}
+	*dst = n
+	return nil
+}
+
+// envFloat is envInt for rates.
+func envFloat(name string, dst *float64) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: not a number", name, v)
+	}
+	*dst = n
+	return nil
+}
+
+func (c Config) validate() error {
+	if c.Listen == "" {
+		return errors.New("listen address must not be empty")
+	}
+	if c.Database == "" {
+		return errors.New("database path must not be empty")
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid log level %q", c.LogLevel)
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid log format %q", c.LogFormat)
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+	if c.Backup.Interval != "" {
+		interval, err := time.ParseDuration(c.Backup.Interval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid backup interval %q", c.Backup.Interval)
+		}
+	}
+	if c.Backup.Keep < 1 {
+		return fmt.Errorf("backup keep must be at least 1, got %d", c.Backup.Keep)
+	}
+	if c.Backup.MaxRestoreBytes < 1 {
+		return fmt.Errorf("max restore bytes must be positive, got %d", c.Backup.MaxRestoreBytes)
+	}
+	if c.Attachments.Dir == "" {
+		return errors.New("attachments dir must not be empty")
+	}
+	if c.Attachments.MaxFileBytes < 1 {
+		return fmt.Errorf("max attachment bytes must be positive, got %d", c.Attachments.MaxFileBytes)
+	}
+	if c.Attachments.MaxTaskBytes < 0 {
+		return fmt.Errorf("invalid max task attachment bytes %d", c.Attachments.MaxTaskBytes)
+	}
+	if c.Attachments.QuotaBytes < 0 {
+		return fmt.Errorf("invalid attachment quota %d", c.Attachments.QuotaBytes)
+	}
+	if c.Trash.Retention != "" {
+		retention, err := time.ParseDuration(c.Trash.Retention)
+		if err != nil || retention <= 0 {
+			return fmt.Errorf("invalid trash retention %q", c.Trash.Retention)
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls cert_file and key_file must be set together")
+	}
+	if c.TLS.CertFile != "" && len(c.TLS.ACME.Domains) > 0 {
+		return errors.New("tls cert_file and acme domains are mutually exclusive")
+	}
+	if len(c.TLS.ACME.Domains) > 0 && c.TLS.ACME.CacheDir == "" {
+		return errors.New("acme cache_dir must not be empty")
+	}
+	if c.TLS.RedirectListen != "" && !c.TLS.enabled() {
+		return errors.New("tls redirect_listen requires a certificate or acme domains")
+	}
+	if c.TLS.HSTSMaxAge < 0 {
+		return fmt.Errorf("invalid hsts max age %d", c.TLS.HSTSMaxAge)
+	}
+	if c.Limits.RequestsPerSecond < 0 {
+		return fmt.Errorf("invalid rate limit %g", c.Limits.RequestsPerSecond)
+	}
+	if c.Limits.RequestsPerSecond > 0 && c.Limits.Burst < 1 {
+		return fmt.Errorf("rate limit burst must be at least 1, got %d", c.Limits.Burst)
+	}
+	if c.Limits.MaxBodyBytes < 1 {
+		return fmt.Errorf("max body bytes must be positive, got %d", c.Limits.MaxBodyBytes)
+	}
+	if c.Limits.MaxTitleLength < 1 {
+		return fmt.Errorf("max title length must be positive, got %d", c.Limits.MaxTitleLength)
+	}
+	if c.Limits.MaxDescriptionLength < 0 {
+		return fmt.Errorf("invalid max description length %d", c.Limits.MaxDescriptionLength)
+	}
+	if c.Limits.MaxCommentLength < 1 {
+		return fmt.Errorf("max comment length must be positive, got %d", c.Limits.MaxCommentLength)
+	}
+	if c.Limits.MaxTags < 0 {
+		return fmt.Errorf("invalid max tags %d", c.Limits.MaxTags)
+	}
+	if c.Limits.MaxBulkOperations < 1 {
+		return fmt.Errorf("max bulk operations must be positive, got %d", c.Limits.MaxBulkOperations)
+	}
+	return nil
+}
+
+// redacted returns a copy of the config that is safe to print.
+func (c Config) redacted() Config {
+	if c.AdminToken != "" {
+		c.AdminToken = "********"
+	}
+	return c
+}
+
+// LogValue implements slog.LogValuer so the config can be logged directly.
+// Secrets are always redacted.
+func (c Config) LogValue() slog.Value {
+	c = c.redacted()
+	return slog.GroupValue(
+		slog.String("listen", c.Listen),
+		slog.String("metrics_listen", c.MetricsListen),
+		slog.String("health_listen", c.HealthListen),
+		slog.String("database", c.Database),
+		slog.Any("allowed_origins", c.AllowedOrigins),
+		slog.String("log_level", c.LogLevel),
+		slog.String("log_format", c.LogFormat),
+		slog.String("timezone", c.Timezone),
+		slog.String("admin_token", c.AdminToken),
+		slog.String("backup_interval", c.Backup.Interval),
+		slog.String("backup_dir", c.Backup.Dir),
+		slog.Int("backup_keep", c.Backup.Keep),
+		slog.String("attachments_dir", c.Attachments.Dir),
+		slog.Int64("attachment_quota_bytes", c.Attachments.QuotaBytes),
+		slog.String("trash_retention", c.Trash.Retention),
+		slog.String("tls_cert_file", c.TLS.CertFile),
+		slog.Any("acme_domains", c.TLS.ACME.Domains),
+		slog.String("acme_directory_url", c.TLS.ACME.DirectoryURL),
+		slog.String("tls_redirect_listen", c.TLS.RedirectListen),
+		slog.Float64("rate_limit", c.Limits.RequestsPerSecond),
+		slog.Int("rate_limit_burst", c.Limits.Burst),
+		slog.Int64("max_body_bytes", c.Limits.MaxBodyBytes),
+	)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
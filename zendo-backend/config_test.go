@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zendo.yaml")
+	err := os.WriteFile(path, []byte(`
+listen: ":9000"
+database: /data/file.db
+log_level: debug
+timezone: Europe/Berlin
+limits:
+  max_tags: 5
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ZENDO_DATABASE", "/data/env.db")
+	t.Setenv("ZENDO_LOG_LEVEL", "warn")
+	t.Setenv("TZ", "Asia/Tokyo")
+
+	cfg, err := loadConfig(configFlags{path: path, logLevel: "error"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	for _, tc := range []struct{ name, got, want string }{
+		{"listen from the file", cfg.Listen, ":9000"},
+		{"database from the environment", cfg.Database, "/data/env.db"},
+		{"log level from the flag", cfg.LogLevel, "error"},
+		{"timezone from the file over TZ", cfg.Timezone, "Europe/Berlin"},
+		{"log format from the defaults", cfg.LogFormat, "text"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+	if cfg.Limits.MaxTags != 5 {
+		t.Errorf("max tags = %d, want 5 from the file", cfg.Limits.MaxTags)
+	}
+
+	if _, err := loadConfig(configFlags{path: filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("loading an explicit missing config file succeeded")
+	}
+	if _, err := loadConfig(configFlags{path: path, timezone: "Mars/Olympus"}); err == nil {
+		t.Error("loading an invalid timezone succeeded")
+	}
+}
+
+func TestLoadConfigTimezone(t *testing.T) {
+	dir := t.TempDir()
+	withZone := filepath.Join(dir, "zone.yaml")
+	withoutZone := filepath.Join(dir, "plain.yaml")
+	os.WriteFile(withZone, []byte("timezone: Europe/Berlin\n"), 0600)
+	os.WriteFile(withoutZone, []byte("log_level: info\n"), 0600)
+
+	for _, tc := range []struct {
+		name, path, zendoTZ, tz, want string
+	}{
+		{"default", withoutZone, "", "", "America/Los_Angeles"},
+		{"TZ without anything else", withoutZone, "", "Asia/Tokyo", "Asia/Tokyo"},
+		{"file over TZ", withZone, "", "Asia/Tokyo", "Europe/Berlin"},
+		{"ZENDO_TIMEZONE over the file", withZone, "UTC", "Asia/Tokyo", "UTC"},
+	} {
+		t.Setenv("ZENDO_TIMEZONE", tc.zendoTZ)
+		t.Setenv("TZ", tc.tz)
+		cfg, err := loadConfig(configFlags{path: tc.path})
+		if err != nil || cfg.Timezone != tc.want {
+			t.Errorf("%s: timezone %q, %v; want %q", tc.name, cfg.Timezone, err, tc.want)
+		}
+	}
+}
+
+func TestLoadConfigRejectsBadNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zendo.yaml")
+	os.WriteFile(path, []byte("log_level: info\n"), 0600)
+
+	for _, name := range []string{"ZENDO_MAX_TAGS", "ZENDO_MAX_BODY_BYTES", "ZENDO_RATE_LIMIT"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, "lots")
+			if _, err := loadConfig(configFlags{path: path}); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("loadConfig with %s=lots: %v, want an error naming it", name, err)
+			}
+		})
+	}
+}
+
+func TestConfigRedactsAdminToken(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AdminToken = "s3cret-token"
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("Starting", "config", cfg)
+	if strings.Contains(buf.String(), "s3cret-token") || !strings.Contains(buf.String(), "config.admin_token=********") {
+		t.Errorf("logged config does not redact the admin token: %s", buf.String())
+	}
+	if cfg.AdminToken != "s3cret-token" {
+		t.Error("logging the config changed its admin token")
+	}
+
+	cfg.AdminToken = ""
+	buf.Reset()
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("Starting", "config", cfg)
+	if !strings.Contains(buf.String(), `config.admin_token=""`) {
+		t.Errorf("an unset admin token should be logged empty: %s", buf.String())
+	}
+}
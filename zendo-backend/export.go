@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumn describes a column that can be selected in a CSV export.
+type csvColumn struct {
+	name  string
+	value func(task *Task) string
+}
+
+// csvColumns lists every exportable column. The computed columns "date"
+// and "completionLatency" are derived from the stored fields.
+var csvColumns = []csvColumn{
+	{"id", func(t *Task) string { return strconv.Itoa(t.ID) }},
+	{"title", func(t *Task) string { return t.Title }},
+	{"description", func(t *Task) string { return t.Description }},
+	{"completed", func(t *Task) string { return strconv.FormatBool(t.Completed) }},
+	{"dayOfWeek", func(t *Task) string { return t.DayOfWeek }},
+	{"weekDate", func(t *Task) string { return t.WeekDate }},
+	{"tags", func(t *Task) string { return t.Tags }},
+	{"urgent", func(t *Task) string { return strconv.FormatBool(t.Urgent) }},
+	{"important", func(t *Task) string { return strconv.FormatBool(t.Important) }},
+	{"projectId", func(t *Task) string {
+		if t.ProjectID == nil {
+			return ""
+		}
+		return strconv.Itoa(*t.ProjectID)
+	}},
+	{"createdAt", func(t *Task) string { return t.CreatedAt.Format(time.RFC3339) }},
+	{"updatedAt", func(t *Task) string { return t.UpdatedAt.Format(time.RFC3339) }},
+	{"date", func(t *Task) string {
+		date, ok := taskDate(t)
+		if !ok {
+			return ""
+		}
+		return date.Format("2006-01-02")
+	}},
+	{"completionLatency", func(t *Task) string {
+		// There is no separate completion timestamp, so the last update of
+		// a completed task is taken as the time it was completed.
+		if !t.Completed {
+			return ""
+		}
+		return t.UpdatedAt.Sub(t.CreatedAt).Round(time.Second).String()
+	}},
+}
+
+// defaultCSVColumns are exported when no columns are requested.
+var defaultCSVColumns = []string{"id", "title", "completed", "dayOfWeek", "weekDate", "tags", "urgent", "important", "createdAt", "updatedAt"}
+
+var weekdayOffsets = map[string]int{
+	"sunday":    0,
+	"monday":    1,
+	"tuesday":   2,
+	"wednesday": 3,
+	"thursday":  4,
+	"friday":    5,
+	"saturday":  6,
+}
+
+// taskDate returns the calendar date a task is scheduled on.
+func taskDate(task *Task) (time.Time, bool) {
+	weekStart, err := time.ParseInLocation("2006-01-02", task.WeekDate, timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	offset, ok := weekdayOffsets[strings.ToLower(task.DayOfWeek)]
+	if !ok {
+		return time.Time{}, false
+	}
+	return weekStart.AddDate(0, 0, offset), true
+}
+
+func lookupCSVColumns(names []string) ([]csvColumn, error) {
+	var columns []csvColumn
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, column := range csvColumns {
+			if column.name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+func exportTasksCSV(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	query := r.URL.Query()
+
+	columnNames := defaultCSVColumns
+	if c := query.Get("columns"); c != "" {
+		columnNames = strings.Split(c, ",")
+	}
+	columns, err := lookupCSVColumns(columnNames)
+	if err != nil {
+		logger.Warn("Invalid export columns", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter",
+			FieldError{Field: "columns", Code: fieldInvalid, Message: err.Error()})
+		return
+	}
+
+	// from and to are inclusive calendar dates.
+	var from, to time.Time
+	if s := query.Get("from"); s != "" {
+		from, err = time.ParseInLocation("2006-01-02", s, timezone)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter",
+				FieldError{Field: "from", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+			return
+		}
+	}
+	if s := query.Get("to"); s != "" {
+		to, err = time.ParseInLocation("2006-01-02", s, timezone)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter",
+				FieldError{Field: "to", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+			return
+		}
+	}
+
+	var tags []string
+	if s := query.Get("tags"); s != "" {
+		for _, tag := range strings.Split(s, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, strings.ToLower(tag))
+			}
+		}
+	}
+
+	// Narrow the scan by week in SQL; exact dates are checked per row.
+	sqlQuery := "SELECT " + taskColumns + " FROM tasks WHERE deleted_at IS NULL"
+	var args []interface{}
+	if !from.IsZero() {
+		sqlQuery += " AND week_date >= ?"
+		args = append(args, getWeekStart(from).Format("2006-01-02"))
+	}
+	if !to.IsZero() {
+		sqlQuery += " AND week_date <= ?"
+		args = append(args, to.Format("2006-01-02"))
+	}
+	if s := query.Get("completed"); s != "" {
+		completed, err := strconv.ParseBool(s)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter",
+				FieldError{Field: "completed", Code: fieldInvalid, Message: "must be true or false"})
+			return
+		}
+		sqlQuery += " AND completed = ?"
+		args = append(args, completed)
+	}
+	where, projectArgs, fieldErrors := parseProjectFilter(query)
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
+	}
+	sqlQuery += where
+	args = append(args, projectArgs...)
+	sqlQuery += " ORDER BY week_date, day_of_week, position, id"
+
+	rows, err := db.QueryContext(r.Context(), sqlQuery, args...)
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="tasks.csv"`)
+
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	writer.Write(header)
+
+	record := make([]string, len(columns))
+	taskCount := 0
+	for rows.Next() {
+		var task Task
+		err := scanTask(rows, &task)
+		if err != nil {
+			// Headers are already sent, so the error can only be logged.
+			logger.Error("Row scan failed", "error", err)
+			break
+		}
+
+		if !from.IsZero() || !to.IsZero() {
+			date, ok := taskDate(&task)
+			if !ok || (!from.IsZero() && date.Before(from)) || (!to.IsZero() && date.After(to)) {
+				continue
+			}
+		}
+		if len(tags) > 0 && !hasAnyTag(task.Tags, tags) {
+			continue
+		}
+
+		for i, column := range columns {
+			record[i] = column.value(&task)
+		}
+		if err := writer.Write(record); err != nil {
+			logger.Error("Failed to write CSV row", "error", err)
+			break
+		}
+		taskCount++
+
+		// Flush regularly so large exports stream instead of buffering.
+		if taskCount%100 == 0 {
+			writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("Row iteration failed", "error", err)
+	}
+	writer.Flush()
+
+	logger.Debug("Exported tasks", "count", taskCount)
+}
+
+// hasAnyTag reports whether the comma-separated tag list contains any of
+// the wanted tags, which must already be lowercase.
+func hasAnyTag(taskTags string, wanted []string) bool {
+	for _, tag := range strings.Split(taskTags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		for _, w := range wanted {
+			if tag == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExportTasksCSV(t *testing.T) {
+	c := newTestClient(t)
+
+	for _, task := range []string{
+		`{"title":"Say \"hi\", then go","description":"line one\nline two","dayOfWeek":"monday","weekDate":"2024-01-07","tags":"Work,home"}`,
+		`{"title":"Saturday","dayOfWeek":"saturday","weekDate":"2024-01-07","tags":"home"}`,
+		`{"title":"Next week","dayOfWeek":"sunday","weekDate":"2024-01-14","tags":"work"}`,
+	} {
+		c.call("POST", "/api/tasks", task)
+	}
+
+	status, data := c.call("GET", "/api/export/tasks.csv?columns=title,description,date,tags", "")
+	if status != http.StatusOK {
+		t.Fatalf("export: status %d, body %s", status, data)
+	}
+	want := "title,description,date,tags\r\n" +
+		"\"Say \"\"hi\"\", then go\",\"line one\r\nline two\",2024-01-08,\"Work,home\"\r\n" +
+		"Saturday,,2024-01-13,home\r\n" +
+		"Next week,,2024-01-14,work\r\n"
+	if string(data) != want {
+		t.Errorf("export =\n%q\nwant\n%q", data, want)
+	}
+
+	for _, tc := range []struct{ query, want string }{
+		// Dates are inclusive and need not fall on a week start.
+		{"from=2024-01-09&to=2024-01-14", "title\r\nSaturday\r\nNext week\r\n"},
+		{"to=2024-01-08", "title\r\n\"Say \"\"hi\"\", then go\"\r\n"},
+		// Tags match case-insensitively, any of the listed ones.
+		{"tags=WORK", "title\r\n\"Say \"\"hi\"\", then go\"\r\nNext week\r\n"},
+		{"tags=home&from=2024-01-10", "title\r\nSaturday\r\n"},
+	} {
+		if _, data := c.call("GET", "/api/export/tasks.csv?columns=title&"+tc.query, ""); string(data) != tc.want {
+			t.Errorf("export with %s = %q, want %q", tc.query, data, tc.want)
+		}
+	}
+
+	_, data = c.call("GET", "/api/export/tasks.csv?to=2024-01-07", "")
+	if want := "id,title,completed,dayOfWeek,weekDate,tags,urgent,important,createdAt,updatedAt\r\n"; string(data) != want {
+		t.Errorf("default columns = %q, want %q", data, want)
+	}
+
+	for _, query := range []string{"columns=title,secret", "from=01/08/2024", "completed=maybe"} {
+		if status, _ := c.call("GET", "/api/export/tasks.csv?"+query, ""); status != http.StatusBadRequest {
+			t.Errorf("export with %s: status %d, want 400", query, status)
+		}
+	}
+}
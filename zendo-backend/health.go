@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=abc123 -X main.buildTime=2026-01-01T00:00:00Z"
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+func init() {
+	// Fall back to the VCS information embedded by the Go toolchain.
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if commit == "" {
+				commit = setting.Value
+			}
+		case "vcs.time":
+			if buildTime == "" {
+				buildTime = setting.Value
+			}
+		}
+	}
+}
+
+// healthRouter serves the health checks and build information on their own,
+// for the health_listen address.
+func healthRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthz)
+	mux.HandleFunc("GET /readyz", readyz)
+	mux.HandleFunc("GET /api/version", getVersion)
+	return mux
+}
+
+// healthz reports that the process is up. It does not touch the database.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readyz reports whether the server can serve requests: the database is
+// reachable, migrations are applied and the storage directory is writable.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	checks := make(map[string]string)
+	ready := true
+
+	fail := func(name string, err error) {
+		logger.Warn("Readiness check failed", "check", name, "error", err)
+		checks[name] = "failed"
+		ready = false
+	}
+
+	if err := db.PingContext(r.Context()); err != nil {
+		fail("database", err)
+	} else {
+		checks["database"] = "ok"
+	}
+
+	var userVersion int
+	if err := db.QueryRowContext(r.Context(), "PRAGMA user_version").Scan(&userVersion); err != nil {
+		fail("migrations", err)
+	} else if userVersion != schemaVersion {
+		logger.Warn("Readiness check failed", "check", "migrations", "schema_version", userVersion, "expected", schemaVersion)
+		checks["migrations"] = "pending"
+		ready = false
+	} else {
+		checks["migrations"] = "ok"
+	}
+
+	if err := checkWritable(filepath.Dir(config.Database)); err != nil {
+		fail("storage", err)
+	} else {
+		checks["storage"] = "ok"
+	}
+
+	status := "ok"
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// checkWritable creates and removes a temporary file in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return err
+	}
+	return os.Remove(name)
+}
+
+func getVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":       version,
+		"commit":        commit,
+		"buildTime":     buildTime,
+		"goVersion":     runtime.Version(),
+		"schemaVersion": schemaVersion,
+	})
+}
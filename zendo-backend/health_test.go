@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestHealthChecks(t *testing.T) {
+	newTestClient(t)
+	saved := config.Database
+	config.Database = filepath.Join(t.TempDir(), "zendo.db")
+	t.Cleanup(func() { config.Database = saved })
+	mux, err := newRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// get requests path from handler and decodes the JSON body.
+	get := func(handler http.Handler, path string) (int, map[string]interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v, body %s", path, err, rec.Body)
+		}
+		return rec.Code, body
+	}
+
+	for _, handler := range []http.Handler{mux, healthRouter()} {
+		if status, body := get(handler, "/healthz"); status != http.StatusOK || body["status"] != "ok" {
+			t.Errorf("healthz: status %d, body %v", status, body)
+		}
+		status, body := get(handler, "/readyz")
+		if status != http.StatusOK || body["status"] != "ok" {
+			t.Errorf("readyz: status %d, body %v", status, body)
+		}
+
+		status, body = get(handler, "/api/version")
+		if status != http.StatusOK || body["version"] != version || body["goVersion"] != runtime.Version() ||
+			body["schemaVersion"] != float64(schemaVersion) {
+			t.Errorf("version: status %d, body %v", status, body)
+		}
+		for _, field := range []string{"commit", "buildTime"} {
+			if _, ok := body[field]; !ok {
+				t.Errorf("version has no %s", field)
+			}
+		}
+	}
+
+	// checks returns the checks of a failed readiness probe.
+	checks := func() map[string]interface{} {
+		t.Helper()
+		status, body := get(healthRouter(), "/readyz")
+		if status != http.StatusServiceUnavailable || body["status"] != "unavailable" {
+			t.Errorf("readyz: status %d, body %v; want 503", status, body)
+		}
+		checks, _ := body["checks"].(map[string]interface{})
+		return checks
+	}
+
+	if _, err := db.Exec("PRAGMA user_version = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := checks(); got["migrations"] != "pending" || got["database"] != "ok" {
+		t.Errorf("checks with pending migrations = %v", got)
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Database = filepath.Join(t.TempDir(), "missing", "zendo.db")
+	if got := checks(); got["storage"] != "failed" || got["migrations"] != "ok" {
+		t.Errorf("checks with unwritable storage = %v", got)
+	}
+}
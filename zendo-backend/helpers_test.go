@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestServer starts the real handlers on a fresh database.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	dir := t.TempDir()
+	saved := config.Attachments
+	config.Attachments.Dir = filepath.Join(dir, "attachments")
+	t.Cleanup(func() { config.Attachments = saved })
+
+	if err := openDatabase(filepath.Join(dir, "zendo.db")); err != nil {
+		t.Fatalf("openDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mux, err := newRouter()
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+	server := httptest.NewServer(authenticate(auditContext(mux)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testClient sends requests to a test server, failing the test on transport
+// errors instead of returning them.
+type testClient struct {
+	t      *testing.T
+	server *httptest.Server
+}
+
+// newTestClient starts the real handlers on a fresh database and returns a
+// client for them.
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+	return &testClient{t: t, server: newTestServer(t)}
+}
+
+// call sends body to path and returns the response status and body. header
+// holds extra request headers as name, value pairs; empty values are not sent.
+func (c *testClient) call(method, path, body string, header ...string) (int, []byte) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		if header[i+1] != "" {
+			req.Header.Set(header[i], header[i+1])
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// decode unmarshals a response body, failing the test if it is not valid JSON.
+func (c *testClient) decode(data []byte, v interface{}) {
+	c.t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		c.t.Fatalf("decoding %s: %v", data, err)
+	}
+}
+
+// task fetches the task with the given ID.
+func (c *testClient) task(id int) Task {
+	c.t.Helper()
+	_, data := c.call("GET", fmt.Sprintf("/api/tasks/%d", id), "")
+	var task Task
+	c.decode(data, &task)
+	return task
+}
+
+// titles returns the titles of the tasks listed at path, comma-separated.
+func (c *testClient) titles(path string) string {
+	c.t.Helper()
+	_, data := c.call("GET", path, "")
+	var tasks []Task
+	c.decode(data, &tasks)
+	var names []string
+	for _, task := range tasks {
+		names = append(names, task.Title)
+	}
+	return strings.Join(names, ",")
+}
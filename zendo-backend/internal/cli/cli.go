@@ -0,0 +1,424 @@
+// Package cli implements the zendoctl command-line client. The zendo server
+// binary runs its task commands too.
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var days = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(env *env, args []string) error
+}
+
+var commands []command
+
+// TaskCommands are the commands that work on tasks. The zendo server binary
+// accepts them as its own subcommands, so "zendo add" works like
+// "zendoctl add".
+var TaskCommands = []string{"add", "ls", "week", "done", "undone", "rm"}
+
+func init() {
+	commands = []command{
+		{"add", "add TITLE [--day DAY] [--week DATE] [--tag TAG]...", "Create a task", runAdd},
+		{"ls", "ls [--today | --week DATE | --all] [--tag TAG]", "List tasks (default: this week)", runList},
+		{"week", "week DATE", "List the tasks of the week containing DATE", runWeek},
+		{"done", "done ID...", "Mark tasks as completed", runDone},
+		{"undone", "undone ID...", "Mark tasks as not completed", runUndone},
+		{"rm", "rm ID...", "Delete tasks", runRemove},
+		{"config", "config [--save] [--server URL] [--token TOKEN]", "Show or save client configuration", runConfig},
+		{"completion", "completion bash|zsh|fish", "Print a shell completion script", runCompletion},
+	}
+}
+
+// env carries the state shared by every command.
+type env struct {
+	prog   string
+	config Config
+	client *Client
+	json   bool
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// globalFlags registers the flags accepted by every command.
+func (e *env) globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&e.config.Server, "server", e.config.Server, "Zendo server URL")
+	fs.StringVar(&e.config.Token, "token", e.config.Token, "API token")
+	fs.BoolVar(&e.json, "json", false, "print JSON instead of a table")
+}
+
+// Run executes the command line args and returns the process exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	return RunAs("zendoctl", args, stdout, stderr)
+}
+
+// RunAs is Run for a program with another name, used in messages.
+func RunAs(prog string, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return 0
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: failed to load config: %v\n", prog, err)
+		return 1
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		e := &env{prog: prog, config: config, stdout: stdout, stderr: stderr}
+		if err := cmd.run(e, args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			fmt.Fprintf(stderr, "%s %s: %v\n", prog, cmd.name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "%s: unknown command %q\n", prog, args[0])
+	printUsage(stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: zendoctl COMMAND [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.usage, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags: --server URL, --token TOKEN, --json")
+}
+
+// newFlagSet returns a flag set for the named command with the global flags registered.
+func (e *env) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(e.prog+" "+name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	e.globalFlags(fs)
+	return fs
+}
+
+// parse parses args allowing flags and positional arguments to be mixed,
+// so "zendoctl add "Write report" --day tue" works, and sets up the client.
+func (e *env) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	e.client = NewClient(e.config.Server, e.config.Token)
+	if u, err := user.Current(); err == nil {
+		e.client.Actor = u.Username
+	}
+	return positional, nil
+}
+
+// stringList is a flag that can be given multiple times.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// normalizeDay turns "tue", "Tuesday" or "2" into "tuesday".
+func normalizeDay(day string) (string, error) {
+	day = strings.ToLower(strings.TrimSpace(day))
+	if n, err := strconv.Atoi(day); err == nil && n >= 0 && n < len(days) {
+		return days[n], nil
+	}
+	if len(day) >= 2 {
+		for _, d := range days {
+			if strings.HasPrefix(d, day) {
+				return d, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("invalid day %q", day)
+}
+
+// weekStart returns the Sunday starting the week that contains t.
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, -int(t.Weekday()))
+}
+
+// parseWeek parses a YYYY-MM-DD date and returns the Sunday of its week.
+func parseWeek(s string) (string, error) {
+	date, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return weekStart(date).Format("2006-01-02"), nil
+}
+
+func parseIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, errors.New("at least one task ID is required")
+	}
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid task ID %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func runAdd(e *env, args []string) error {
+	fs := e.newFlagSet("add")
+	day := fs.String("day", "", "day of week (default: today)")
+	week := fs.String("week", "", "any date in the target week (default: this week)")
+	var tags stringList
+	fs.Var(&tags, "tag", "tag to add (repeatable)")
+	positional, err := e.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	title := strings.TrimSpace(strings.Join(positional, " "))
+	if title == "" {
+		return errors.New("a title is required")
+	}
+
+	var dayOfWeek, weekDate string
+	if *day != "" {
+		if dayOfWeek, err = normalizeDay(*day); err != nil {
+			return err
+		}
+	}
+	if *week != "" {
+		if weekDate, err = parseWeek(*week); err != nil {
+			return err
+		}
+	}
+	if dayOfWeek == "" || weekDate == "" {
+		// Default to today as the server sees it, not the local clock.
+		today, err := e.client.Today()
+		if err != nil {
+			return err
+		}
+		if dayOfWeek == "" {
+			dayOfWeek = days[today.Weekday()]
+		}
+		if weekDate == "" {
+			weekDate = weekStart(today).Format("2006-01-02")
+		}
+	}
+
+	task, err := e.client.CreateTask(title, dayOfWeek, weekDate, strings.Join(tags, ","))
+	if err != nil {
+		return err
+	}
+	return e.printTasks([]Task{*task})
+}
+
+func runList(e *env, args []string) error {
+	fs := e.newFlagSet("ls")
+	today := fs.Bool("today", false, "only today's tasks")
+	all := fs.Bool("all", false, "tasks of every week")
+	week := fs.String("week", "", "any date in the week to list")
+	tag := fs.String("tag", "", "only tasks with this tag")
+	if _, err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	var tasks []Task
+	var err error
+	switch {
+	case *today:
+		tasks, err = e.client.ListToday()
+	case *all:
+		tasks, err = e.client.ListTasks()
+	case *week != "":
+		var weekDate string
+		if weekDate, err = parseWeek(*week); err == nil {
+			tasks, err = e.client.ListWeek(weekDate)
+		}
+	default:
+		tasks, err = e.client.ListCurrentWeek()
+	}
+	if err != nil {
+		return err
+	}
+
+	if *tag != "" {
+		tasks = filterTag(tasks, *tag)
+	}
+	return e.printTasks(tasks)
+}
+
+func runWeek(e *env, args []string) error {
+	positional, err := e.parse(e.newFlagSet("week"), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("exactly one date is required")
+	}
+	weekDate, err := parseWeek(positional[0])
+	if err != nil {
+		return err
+	}
+	tasks, err := e.client.ListWeek(weekDate)
+	if err != nil {
+		return err
+	}
+	return e.printTasks(tasks)
+}
+
+func runDone(e *env, args []string) error {
+	return setCompleted(e, "done", args, true)
+}
+
+func runUndone(e *env, args []string) error {
+	return setCompleted(e, "undone", args, false)
+}
+
+func setCompleted(e *env, name string, args []string, completed bool) error {
+	positional, err := e.parse(e.newFlagSet(name), args)
+	if err != nil {
+		return err
+	}
+	ids, err := parseIDs(positional)
+	if err != nil {
+		return err
+	}
+
+	updated, err := e.client.SetCompleted(ids, completed)
+	if err != nil {
+		return err
+	}
+	return e.printTasks(updated)
+}
+
+func runRemove(e *env, args []string) error {
+	positional, err := e.parse(e.newFlagSet("rm"), args)
+	if err != nil {
+		return err
+	}
+	ids, err := parseIDs(positional)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := e.client.DeleteTask(id); err != nil {
+			return err
+		}
+		if !e.json {
+			fmt.Fprintf(e.stdout, "Deleted task %d\n", id)
+		}
+	}
+	if e.json {
+		return json.NewEncoder(e.stdout).Encode(map[string][]int{"deleted": ids})
+	}
+	return nil
+}
+
+func runConfig(e *env, args []string) error {
+	fs := e.newFlagSet("config")
+	save := fs.Bool("save", false, "write the effective configuration to the config file")
+	if _, err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	if *save {
+		path, err := SaveConfig(e.config)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "Saved configuration to %s\n", path)
+		return nil
+	}
+
+	shown := e.config
+	if shown.Token != "" {
+		shown.Token = "********"
+	}
+	if e.json {
+		return json.NewEncoder(e.stdout).Encode(shown)
+	}
+	fmt.Fprintf(e.stdout, "server: %s\ntoken:  %s\n", shown.Server, shown.Token)
+	return nil
+}
+
+func filterTag(tasks []Task, tag string) []Task {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	var filtered []Task
+	for _, task := range tasks {
+		for _, t := range strings.Split(task.Tags, ",") {
+			if strings.ToLower(strings.TrimSpace(t)) == tag {
+				filtered = append(filtered, task)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// printTasks writes tasks as JSON or as a table sorted by week and day.
+func (e *env) printTasks(tasks []Task) error {
+	if tasks == nil {
+		tasks = []Task{}
+	}
+	if e.json {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tasks)
+	}
+
+	dayIndex := make(map[string]int, len(days))
+	for i, d := range days {
+		dayIndex[d] = i
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].WeekDate != tasks[j].WeekDate {
+			return tasks[i].WeekDate < tasks[j].WeekDate
+		}
+		return dayIndex[tasks[i].DayOfWeek] < dayIndex[tasks[j].DayOfWeek]
+	})
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDONE\tDAY\tWEEK\tTAGS\tTITLE")
+	for _, task := range tasks {
+		done := " "
+		if task.Completed {
+			done = "x"
+		}
+		fmt.Fprintf(tw, "%d\t[%s]\t%s\t%s\t%s\t%s\n", task.ID, done, task.DayOfWeek, task.WeekDate, task.Tags, task.Title)
+	}
+	return tw.Flush()
+}
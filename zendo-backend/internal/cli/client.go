@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Task mirrors the task JSON returned by the server.
+type Task struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Completed   bool      `json:"completed"`
+	DayOfWeek   string    `json:"dayOfWeek"`
+	WeekDate    string    `json:"weekDate"`
+	Tags        string    `json:"tags"`
+	Urgent      bool      `json:"urgent"`
+	Important   bool      `json:"important"`
+	ProjectID   *int      `json:"projectId,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// taskPayload is the body sent when creating or updating a task.
+type taskPayload struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Completed   bool   `json:"completed"`
+	DayOfWeek   string `json:"dayOfWeek"`
+	WeekDate    string `json:"weekDate"`
+	Tags        string `json:"tags"`
+	Urgent      bool   `json:"urgent"`
+	Important   bool   `json:"important"`
+	ProjectID   *int   `json:"projectId,omitempty"`
+}
+
+// Client talks to the Zendo HTTP API.
+type Client struct {
+	BaseURL string
+	Token   string
+	// Actor is the name changes are attributed to in the server's audit log.
+	Actor      string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the server at baseURL.
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *Client) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	req.Header.Set("X-Zendo-Source", "cli")
+	if c.Actor != "" {
+		req.Header.Set("X-Zendo-Actor", c.Actor)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, errorMessage(resp.Header.Get("Content-Type"), msg))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// problem is the subset of an RFC 9457 problem response shown to users.
+type problem struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+	Errors []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	// Results are sent with a failed bulk request; the failed operation
+	// carries the reason.
+	Results []struct {
+		ID    int `json:"id"`
+		Error *struct {
+			Detail string `json:"detail"`
+		} `json:"error"`
+	} `json:"results"`
+}
+
+// errorMessage formats an error response body, expanding problem details
+// into the detail text and any field errors.
+func errorMessage(contentType string, body []byte) string {
+	var p problem
+	if !strings.HasPrefix(contentType, "application/problem+json") || json.Unmarshal(body, &p) != nil {
+		return strings.TrimSpace(string(body))
+	}
+	msg := p.Detail
+	for _, e := range p.Errors {
+		msg += fmt.Sprintf("; %s %s", e.Field, e.Message)
+	}
+	for _, r := range p.Results {
+		if r.Error != nil {
+			msg += fmt.Sprintf("; task %d: %s", r.ID, r.Error.Detail)
+		}
+	}
+	return msg
+}
+
+// ListTasks returns every task.
+func (c *Client) ListTasks() ([]Task, error) {
+	var tasks []Task
+	err := c.do(http.MethodGet, "/api/tasks", nil, &tasks)
+	return tasks, err
+}
+
+// ListToday returns the tasks scheduled for today on the server.
+func (c *Client) ListToday() ([]Task, error) {
+	var tasks []Task
+	err := c.do(http.MethodGet, "/api/tasks/today", nil, &tasks)
+	return tasks, err
+}
+
+// ListCurrentWeek returns the tasks of the server's current week.
+func (c *Client) ListCurrentWeek() ([]Task, error) {
+	var tasks []Task
+	err := c.do(http.MethodGet, "/api/tasks/today/week", nil, &tasks)
+	return tasks, err
+}
+
+// ListWeek returns the tasks of the week starting on weekDate.
+func (c *Client) ListWeek(weekDate string) ([]Task, error) {
+	var tasks []Task
+	err := c.do(http.MethodGet, "/api/tasks/week/"+weekDate, nil, &tasks)
+	return tasks, err
+}
+
+// Today returns the current date in the server's configured timezone, so
+// tasks land on the same day the server and the web app consider today.
+func (c *Client) Today() (time.Time, error) {
+	var info struct {
+		LocalTime string `json:"current_local_time"`
+	}
+	if err := c.do(http.MethodGet, "/api/timezone", nil, &info); err != nil {
+		return time.Time{}, err
+	}
+	today, err := time.Parse("2006-01-02 15:04:05", info.LocalTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading the server time %q: %w", info.LocalTime, err)
+	}
+	return today, nil
+}
+
+// CreateTask creates a task and returns it.
+func (c *Client) CreateTask(title, dayOfWeek, weekDate, tags string) (*Task, error) {
+	var task Task
+	err := c.do(http.MethodPost, "/api/tasks", taskPayload{
+		Title:     title,
+		DayOfWeek: dayOfWeek,
+		WeekDate:  weekDate,
+		Tags:      tags,
+	}, &task)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// bulkOperation is one operation of a bulk request.
+type bulkOperation struct {
+	Op        string `json:"op"`
+	ID        int    `json:"id"`
+	Completed *bool  `json:"completed,omitempty"`
+}
+
+// SetCompleted completes or reopens the tasks with the given IDs in one
+// atomic bulk request. Only the completed flag is written, so concurrent
+// edits to other fields are kept.
+func (c *Client) SetCompleted(ids []int, completed bool) ([]Task, error) {
+	operations := make([]bulkOperation, len(ids))
+	for i, id := range ids {
+		operations[i] = bulkOperation{Op: "complete", ID: id, Completed: &completed}
+	}
+	var resp struct {
+		Results []struct {
+			Task Task `json:"task"`
+		} `json:"results"`
+	}
+	err := c.do(http.MethodPost, "/api/tasks/bulk", map[string]interface{}{
+		"mode":       "atomic",
+		"operations": operations,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, len(resp.Results))
+	for i, result := range resp.Results {
+		tasks[i] = result.Task
+	}
+	return tasks, nil
+}
+
+// DeleteTask deletes the task with the given ID.
+func (c *Client) DeleteTask(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/api/tasks/%d", id), nil, nil)
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const bashCompletion = `# bash completion for zendoctl
+_zendoctl() {
+	local cur prev
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "%[1]s" -- "$cur"))
+		return
+	fi
+
+	case "$prev" in
+	--day)
+		COMPREPLY=($(compgen -W "%[2]s" -- "$cur"))
+		return
+		;;
+	completion)
+		COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+		return
+		;;
+	esac
+
+	COMPREPLY=($(compgen -W "--server --token --json --day --week --tag --today --all --save" -- "$cur"))
+}
+complete -F _zendoctl zendoctl
+`
+
+const zshCompletion = `#compdef zendoctl
+_zendoctl() {
+	if (( CURRENT == 2 )); then
+		compadd %[1]s
+		return
+	fi
+	case "${words[CURRENT-1]}" in
+	--day) compadd %[2]s ;;
+	completion) compadd bash zsh fish ;;
+	*) compadd -- --server --token --json --day --week --tag --today --all --save ;;
+	esac
+}
+compdef _zendoctl zendoctl
+`
+
+const fishCompletion = `# fish completion for zendoctl
+complete -c zendoctl -f
+complete -c zendoctl -n "__fish_use_subcommand" -a "%[1]s"
+complete -c zendoctl -l server -r -d "Zendo server URL"
+complete -c zendoctl -l token -r -d "API token"
+complete -c zendoctl -l json -d "Print JSON"
+complete -c zendoctl -n "__fish_seen_subcommand_from add" -l day -x -a "%[2]s"
+complete -c zendoctl -n "__fish_seen_subcommand_from add" -l week -r
+complete -c zendoctl -n "__fish_seen_subcommand_from add" -l tag -r
+complete -c zendoctl -n "__fish_seen_subcommand_from ls" -l today
+complete -c zendoctl -n "__fish_seen_subcommand_from ls" -l all
+complete -c zendoctl -n "__fish_seen_subcommand_from ls" -l week -r
+complete -c zendoctl -n "__fish_seen_subcommand_from ls" -l tag -r
+complete -c zendoctl -n "__fish_seen_subcommand_from config" -l save
+complete -c zendoctl -n "__fish_seen_subcommand_from completion" -a "bash zsh fish"
+`
+
+func runCompletion(e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: zendoctl completion bash|zsh|fish")
+	}
+
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	commandList := strings.Join(names, " ")
+	dayList := strings.Join(days, " ")
+
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return fmt.Errorf("unsupported shell %q", args[0])
+	}
+	_, err := fmt.Fprintf(e.stdout, script, commandList, dayList)
+	return err
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// defaultServerURL is used when no server is configured.
+const defaultServerURL = "http://localhost:8080"
+
+// Config holds the client settings. Values are read from the config file,
+// then overridden by the ZENDO_SERVER and ZENDO_TOKEN environment variables
+// and finally by command-line flags.
+type Config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// configPath returns the config file location, honouring ZENDO_CONFIG.
+func configPath() (string, error) {
+	if path := os.Getenv("ZENDO_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "zendo", "config.json"), nil
+}
+
+// LoadConfig reads the config file and applies environment overrides.
+// A missing config file is not an error.
+func LoadConfig() (Config, error) {
+	config := Config{Server: defaultServerURL}
+
+	path, err := configPath()
+	if err == nil {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return config, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &config); err != nil {
+				return config, err
+			}
+		}
+	}
+
+	if server := os.Getenv("ZENDO_SERVER"); server != "" {
+		config.Server = server
+	}
+	if token := os.Getenv("ZENDO_TOKEN"); token != "" {
+		config.Token = token
+	}
+	return config, nil
+}
+
+// SaveConfig writes config to the config file.
+func SaveConfig(config Config) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(data, '\n'), 0600)
+}
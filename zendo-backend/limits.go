@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// rateLimiter is a token bucket per client. Each client may make burst
+// requests at once, refilled at rate requests per second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose buckets have refilled completely, at most once
+// a minute, so the map does not grow with every address ever seen.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rateLimitClient identifies the caller: by API user when authenticate
+// accepted their token, otherwise by IP address. Unverified tokens are
+// ignored, or a client could dodge its limit by sending a new one each time.
+func rateLimitClient(r *http.Request) string {
+	if user := userFrom(r.Context()); user != "" {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit throttles API requests per client, answering 429 with a
+// Retry-After header once a client's bucket is empty. Static assets, health
+// checks and metrics are not limited. A zero rate disables limiting.
+func rateLimit(next http.Handler, rate float64, burst int) http.Handler {
+	if rate <= 0 {
+		return next
+	}
+	limiter := newRateLimiter(rate, burst)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := rateLimitClient(r)
+		ok, wait := limiter.allow(client, time.Now())
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			requestLogger(r).Warn("Rate limit exceeded", "client", client, "retry_after", seconds)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited,
+				fmt.Sprintf("Too many requests, retry in %d seconds", seconds))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody caps the size of the request body read by next.
+func limitBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, config.Limits.MaxBodyBytes)
+		next(w, r)
+	}
+}
+
+// validateTaskLimits checks the title, description and tags of a task
+// against the configured caps.
+func validateTaskLimits(title, description, tags string) []FieldError {
+	var fieldErrors []FieldError
+	if n := utf8.RuneCountInString(title); n > config.Limits.MaxTitleLength {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "title",
+			Code:    fieldTooLong,
+			Message: fmt.Sprintf("must be at most %d characters, got %d", config.Limits.MaxTitleLength, n),
+		})
+	}
+	if n := utf8.RuneCountInString(description); n > config.Limits.MaxDescriptionLength {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "description",
+			Code:    fieldTooLong,
+			Message: fmt.Sprintf("must be at most %d characters, got %d", config.Limits.MaxDescriptionLength, n),
+		})
+	}
+	var count int
+	for _, tag := range strings.Split(tags, ",") {
+		if strings.TrimSpace(tag) != "" {
+			count++
+		}
+	}
+	if count > config.Limits.MaxTags {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "tags",
+			Code:    fieldTooMany,
+			Message: fmt.Sprintf("must have at most %d tags, got %d", config.Limits.MaxTags, count),
+		})
+	}
+	return fieldErrors
+}
+
+// maxAuthorLength caps comment author names, in characters.
+const maxAuthorLength = 100
+
+// maxTemplateNameLength caps template names, in characters.
+const maxTemplateNameLength = 100
+
+// maxProjectNameLength caps project names, in characters.
+const maxProjectNameLength = 100
+
+// validateCommentLimits checks a comment against the configured caps.
+func validateCommentLimits(author, body string) []FieldError {
+	var fieldErrors []FieldError
+	if n := utf8.RuneCountInString(author); n > maxAuthorLength {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "author",
+			Code:    fieldTooLong,
+			Message: fmt.Sprintf("must be at most %d characters, got %d", maxAuthorLength, n),
+		})
+	}
+	if n := utf8.RuneCountInString(body); n > config.Limits.MaxCommentLength {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "body",
+			Code:    fieldTooLong,
+			Message: fmt.Sprintf("must be at most %d characters, got %d", config.Limits.MaxCommentLength, n),
+		})
+	}
+	return fieldErrors
+}
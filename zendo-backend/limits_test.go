@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	newTestClient(t)
+	handler := authenticate(rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 0.01, 2))
+
+	// get sends a request from addr with an optional bearer token.
+	get := func(addr, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/tasks", nil)
+		r.RemoteAddr = addr
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("192.0.2.1:1000", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: status %d", i+1, w.Code)
+		}
+	}
+	w := get("192.0.2.1:1001", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "100" {
+		t.Errorf("Retry-After = %q, want 100", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if !strings.Contains(w.Body.String(), `"code":"rate_limited"`) {
+		t.Errorf("body = %s", w.Body)
+	}
+
+	// Made-up tokens do not get a bucket of their own.
+	for i := 0; i < 3; i++ {
+		if w := get("192.0.2.1:1002", fmt.Sprintf("guess-%d", i)); w.Code != http.StatusTooManyRequests {
+			t.Errorf("unknown token %d: status %d, want 429", i, w.Code)
+		}
+	}
+	// A user's token does, and other addresses are unaffected.
+	token, err := addUser(context.Background(), "ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get("192.0.2.1:1003", token); w.Code != http.StatusOK {
+		t.Errorf("authenticated user: status %d, want 200", w.Code)
+	}
+	if w := get("192.0.2.2:1000", ""); w.Code != http.StatusOK {
+		t.Errorf("other address: status %d, want 200", w.Code)
+	}
+
+	// Only the API is limited.
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	r.RemoteAddr = "192.0.2.1:1004"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("health check: status %d, want 200", w.Code)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	c := newTestClient(t)
+	saved := config.Limits
+	t.Cleanup(func() { config.Limits = saved })
+	config.Limits.MaxBodyBytes = 256
+	config.Limits.MaxTitleLength = 10
+	config.Limits.MaxDescriptionLength = 20
+	config.Limits.MaxTags = 2
+
+	status, data := c.call("POST", "/api/tasks", fmt.Sprintf(`{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07","description":%q}`, strings.Repeat("x", 300)))
+	if status != http.StatusRequestEntityTooLarge || !strings.Contains(string(data), `"code":"payload_too_large"`) {
+		t.Errorf("oversized body: status %d, body %s", status, data)
+	}
+
+	for _, tc := range []struct {
+		name, fields, field, code string
+	}{
+		{"long title", `"title":"Twelve chars"`, "title", fieldTooLong},
+		{"long description", `"title":"Plan","description":"twenty-one characters"`, "description", fieldTooLong},
+		{"too many tags", `"title":"Plan","tags":"a, b, c"`, "tags", fieldTooMany},
+	} {
+		status, data := c.call("POST", "/api/tasks", `{`+tc.fields+`,"dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+		var problem Problem
+		c.decode(data, &problem)
+		if status != http.StatusUnprocessableEntity || len(problem.Errors) != 1 ||
+			problem.Errors[0].Field != tc.field || problem.Errors[0].Code != tc.code {
+			t.Errorf("%s: status %d, body %s", tc.name, status, data)
+		}
+	}
+
+	// Values at the limits are accepted; blank tags do not count.
+	status, data = c.call("POST", "/api/tasks", `{"title":"Ten chars!","description":"twenty characters!!!","tags":"a,,b, ","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	if status != http.StatusCreated {
+		t.Errorf("task at the limits: status %d, body %s", status, data)
+	}
+}
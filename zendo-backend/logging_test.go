@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the default logger's JSON output to the returned buffer
+// for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	saved := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	var buf bytes.Buffer
+	if err := setupLogging(&buf, "debug", "json"); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	logs := captureLogs(t)
+	handler := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestLogger(r).Info("Handling")
+		writeProblem(w, r, http.StatusNotFound, codeTaskNotFound, "Task not found")
+	}))
+
+	for _, tc := range []struct {
+		sent  string
+		reuse bool
+	}{
+		{"client-id.42", true},
+		{"", false},
+		{"has spaces", false},
+		{strings.Repeat("x", 65), false},
+	} {
+		logs.Reset()
+		req := httptest.NewRequest("GET", "/api/tasks/1", nil)
+		if tc.sent != "" {
+			req.Header.Set("X-Request-ID", tc.sent)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		id := rec.Header().Get("X-Request-ID")
+		if tc.reuse && id != tc.sent || !tc.reuse && (id == tc.sent || !validRequestID(id)) {
+			t.Errorf("sent %q, got X-Request-ID %q", tc.sent, id)
+			continue
+		}
+		var problem Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || problem.RequestID != id {
+			t.Errorf("problem for %q = %s, want requestId %q", tc.sent, rec.Body, id)
+		}
+		// Both the handler's line and the access log line carry the ID.
+		lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("got %d log lines, want 2:\n%s", len(lines), logs)
+		}
+		for _, line := range lines {
+			var entry struct {
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.RequestID != id {
+				t.Errorf("log line %s, want request_id %q", line, id)
+			}
+		}
+	}
+}
+
+func TestRouteLabels(t *testing.T) {
+	c := newTestClient(t)
+	c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	token, err := addUser(context.Background(), "ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := newRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The full middleware chain, in which authenticate and auditContext
+	// replace the request before it reaches the mux.
+	server := httptest.NewServer(newHandler(mux))
+	t.Cleanup(server.Close)
+	logs := captureLogs(t)
+
+	for _, tc := range []struct {
+		method, path, token, route string
+		status                     int
+	}{
+		{"GET", "/api/tasks", "", "GET /api/tasks", http.StatusOK},
+		{"GET", "/api/tasks/1", token, "GET /api/tasks/{id}", http.StatusOK},
+		{"GET", "/api/tasks/1/comments", "", "GET /api/tasks/{id}/{list}", http.StatusOK},
+		{"DELETE", "/api/tasks/99", "", "DELETE /api/tasks/{id}", http.StatusNotFound},
+	} {
+		logs.Reset()
+		status := strconv.Itoa(tc.status)
+		before := counterValue(httpRequestsTotal, tc.method, tc.route, status)
+		req, err := http.NewRequest(tc.method, server.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		var entry struct {
+			Msg   string `json:"msg"`
+			Route string `json:"route"`
+		}
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			if json.Unmarshal([]byte(line), &entry) == nil && entry.Msg == "HTTP request" {
+				break
+			}
+		}
+		if entry.Route != tc.route {
+			t.Errorf("%s %s logged with route %q, want %q", tc.method, tc.path, entry.Route, tc.route)
+		}
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, resp.StatusCode, tc.status)
+		}
+		if got := counterValue(httpRequestsTotal, tc.method, tc.route, status) - before; got != 1 {
+			t.Errorf("%s %s counted %g times under route %q", tc.method, tc.path, got, tc.route)
+		}
+	}
+}
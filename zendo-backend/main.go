@@ -1,41 +1,46 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/cors"
 	_ "modernc.org/sqlite"
 )
 
-var timezone *time.Location
+// timezone is used to determine today's date. It is set from the config
+// by setTimezone before any command runs.
+var timezone = time.UTC
 
-func init() {
-	// For now, hardcode to America/Los_Angeles to ensure consistency
-	// This can be made configurable later once we fix the timezone loading issues
+// setTimezone loads the named IANA timezone, falling back to UTC.
+func setTimezone(name string) {
 	var err error
-	timezone, err = time.LoadLocation("America/Los_Angeles")
+	timezone, err = time.LoadLocation(name)
 	if err != nil {
-		log.Printf("Warning: Failed to load America/Los_Angeles timezone, using UTC: %v", err)
+		slog.Warn("Failed to load timezone, using UTC", "timezone", name, "error", err)
 		timezone = time.UTC
 	}
-	
-	log.Printf("Using timezone: %s", timezone.String())
-	
-	// Debug timezone information
+
 	now := time.Now()
-	log.Printf("Current UTC time: %s", now.UTC().Format("2006-01-02 15:04:05"))
-	log.Printf("Current time in configured timezone: %s", now.In(timezone).Format("2006-01-02 15:04:05"))
-	log.Printf("Current time in local timezone: %s", now.Local().Format("2006-01-02 15:04:05"))
-	log.Printf("Timezone offset from UTC: %s", now.In(timezone).Format("-07:00"))
+	slog.Info("Using timezone", "timezone", timezone.String(), "offset", now.In(timezone).Format("-07:00"))
+	slog.Debug("Current time",
+		"utc", now.UTC().Format("2006-01-02 15:04:05"),
+		"configured", now.In(timezone).Format("2006-01-02 15:04:05"),
+		"local", now.Local().Format("2006-01-02 15:04:05"))
 }
 
 //go:embed static/*
@@ -62,7 +67,7 @@ func (sfs spaFileSystem) Open(name string) (http.File, error) {
 		}
 		// For other routes, this is the SPA fallback case.
 		// Serve the index.html from the root of the content filesystem.
-		log.Printf("SPA Fallback: Requested path '%s' not found. Serving 'index.html'.", name)
+		slog.Debug("SPA fallback, serving index.html", "path", name)
 		return sfs.contentRoot.Open("index.html")
 	}
 	// For any other errors, return them.
@@ -85,84 +90,344 @@ func isStaticAsset(name string) bool {
 }
 
 type Task struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Completed   bool      `json:"completed"`
-	DayOfWeek   string    `json:"dayOfWeek"`
-	WeekDate    string    `json:"weekDate"`    // ISO date string for the week (Sunday of the week)
-	Tags        string    `json:"tags"`        // Comma-separated tags
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	ID              int       `json:"id"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"` // Markdown
+	DescriptionHTML string    `json:"descriptionHtml,omitempty"`
+	Checklist       Checklist `json:"checklist"`
+	Completed       bool      `json:"completed"`
+	DayOfWeek       string    `json:"dayOfWeek"`
+	WeekDate        string    `json:"weekDate"` // ISO date string for the week (Sunday of the week)
+	Tags            string    `json:"tags"`     // Comma-separated tags
+	Urgent          bool      `json:"urgent"`
+	Important       bool      `json:"important"`
+	Position        string    `json:"position"` // Rank within the day, see rank.go
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+	ProjectID       *int      `json:"projectId,omitempty"`
+	// DeletedAt is only set on tasks in the trash, see trash.go
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
 }
 
 type CreateTaskRequest struct {
-	Title     string `json:"title"`
-	DayOfWeek string `json:"dayOfWeek"`
-	WeekDate  string `json:"weekDate"`  // ISO date string for the week (Sunday of the week)
-	Tags      string `json:"tags"`      // Comma-separated tags
+	Title       string `json:"title"`
+	Description string `json:"description"` // Markdown
+	DayOfWeek   string `json:"dayOfWeek"`
+	WeekDate    string `json:"weekDate"` // ISO date string for the week (Sunday of the week)
+	Tags        string `json:"tags"`     // Comma-separated tags
+	Urgent      bool   `json:"urgent"`
+	Important   bool   `json:"important"`
+	ProjectID   *int   `json:"projectId,omitempty"` // 0 for none
 }
 
+// UpdateTaskRequest replaces a task. Without a projectId the task stays in
+// its project; 0 takes it out.
 type UpdateTaskRequest struct {
-	Title     string `json:"title"`
-	Completed bool   `json:"completed"`
-	DayOfWeek string `json:"dayOfWeek"`
-	WeekDate  string `json:"weekDate"`  // ISO date string for the week (Sunday of the week)
-	Tags      string `json:"tags"`      // Comma-separated tags
+	Title       string `json:"title"`
+	Description string `json:"description"` // Markdown
+	Completed   bool   `json:"completed"`
+	DayOfWeek   string `json:"dayOfWeek"`
+	WeekDate    string `json:"weekDate"` // ISO date string for the week (Sunday of the week)
+	Tags        string `json:"tags"`     // Comma-separated tags
+	Urgent      bool   `json:"urgent"`
+	Important   bool   `json:"important"`
+	ProjectID   *int   `json:"projectId,omitempty"`
 }
 
 var db *sql.DB
 
+// nowMillis is an SQL expression for the current UTC time with milliseconds,
+// which CURRENT_TIMESTAMP lacks.
+const nowMillis = "(strftime('%Y-%m-%d %H:%M:%f', 'now'))"
+
+// schemaVersion is the current database schema version. It is stored in
+// SQLite's user_version pragma once all migrations have been applied.
+const schemaVersion = 8
+
 func main() {
-	log.Println("=== Starting Zendo server ===")
-	log.Println("Time:", time.Now().Format("2006-01-02 15:04:05"))
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// serve runs the HTTP server with the effective configuration.
+func serve() error {
+	slog.Info("Starting Zendo server", "version", version, "commit", commit, "config", config)
 
-	// Create storage directory if it doesn't exist
-	err := os.MkdirAll("./storage", 0755)
+	// Stop on SIGTERM (docker stop) or SIGINT (Ctrl-C)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// Initialize database
+	err := openDatabase(config.Database)
 	if err != nil {
-		log.Fatal("Failed to create storage directory:", err)
+		return err
 	}
 
-	// Initialize database
-	db, err = sql.Open("sqlite", "./storage/zendo.db")
+	// Start scheduled backups if configured
+	startBackupScheduler(ctx)
+	startTrashPurger(ctx)
+
+	// --- HTTP Route Handling ---
+	mux, err := newRouter()
+	if err != nil {
+		return err
+	}
+
+	handler := newHandler(mux)
+
+	server := newHTTPServer(config.Listen, handler)
+	servers := []*http.Server{server}
+	if config.TLS.enabled() {
+		tlsConfig, acmeChallenges, err := newTLSConfig(config.TLS)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+		server.Handler = strictTransportSecurity(handler, config.TLS.HSTSMaxAge)
+
+		if config.TLS.RedirectListen != "" {
+			redirect := redirectToHTTPS(config.Listen)
+			if acmeChallenges != nil {
+				redirect = acmeChallenges(redirect)
+			}
+			servers = append(servers, newHTTPServer(config.TLS.RedirectListen, logRequests(redirect)))
+		}
+	}
+	if config.MetricsListen != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("GET /metrics", metricsHandler)
+		servers = append(servers, newHTTPServer(config.MetricsListen, metricsMux))
+	}
+	if config.HealthListen != "" {
+		// Plain HTTP, so container health checks work when the main listener uses TLS.
+		servers = append(servers, newHTTPServer(config.HealthListen, healthRouter()))
+	}
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			errs <- listenAndServe(server)
+		}()
+		slog.Info("Server ready", "listen", server.Addr, "tls", server.TLSConfig != nil)
+	}
+
+	select {
+	case err = <-errs:
+		slog.Error("Server stopped unexpectedly", "error", err)
+	case <-ctx.Done():
+		slog.Info("Shutting down", "timeout", shutdownTimeout)
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdown(shutdownCtx, servers...)
+
+	return err
+}
+
+// openDatabase opens the SQLite database at path, creates the tasks table
+// and runs all pending migrations.
+func openDatabase(path string) error {
+	// Create the storage directory if it doesn't exist
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	// WAL mode lets readers such as backups run alongside writes; the busy
+	// timeout makes concurrent writers wait instead of failing.
+	db, err = sql.Open(instrumentedDriverName, path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
 	if err != nil {
-		log.Fatal("Failed to open database:", err)
+		return fmt.Errorf("failed to open database: %w", err)
 	}
-	defer db.Close()
 
-	log.Println("Database connection established successfully")
+	slog.Debug("Database connection established", "path", path)
 
 	// Create tasks table
 	createTableSQL := `
 	CREATE TABLE IF NOT EXISTS tasks (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '', -- Markdown
 		completed BOOLEAN DEFAULT FALSE,
 		day_of_week TEXT NOT NULL,
 		week_date TEXT NOT NULL,
 		tags TEXT, -- Comma-separated tags
+		urgent BOOLEAN NOT NULL DEFAULT FALSE,
+		important BOOLEAN NOT NULL DEFAULT FALSE,
+		position TEXT NOT NULL DEFAULT '', -- Rank within the day, see rank.go
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		deleted_at DATETIME, -- In the trash since, see trash.go
+		project_id INTEGER -- See projects.go
 	);`
 
 	_, err = db.Exec(createTableSQL)
 	if err != nil {
-		log.Fatal("Failed to create tasks table:", err)
+		return fmt.Errorf("failed to create tasks table: %w", err)
+	}
+
+	// Attachment files live on disk under their SHA-256, see attachments.go
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_attachments_task ON attachments (task_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_sha256 ON attachments (sha256);`)
+	if err != nil {
+		return fmt.Errorf("failed to create attachments table: %w", err)
+	}
+
+	// Comments and task events make up the activity stream, see activity.go.
+	// Their timestamps have milliseconds so the two interleave in order.
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS comments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		author TEXT NOT NULL,
+		body TEXT NOT NULL, -- Markdown
+		created_at DATETIME DEFAULT ` + nowMillis + `,
+		updated_at DATETIME DEFAULT ` + nowMillis + `
+	);
+	CREATE INDEX IF NOT EXISTS idx_comments_task ON comments (task_id);
+	CREATE TABLE IF NOT EXISTS task_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		from_value TEXT NOT NULL DEFAULT '',
+		to_value TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT ` + nowMillis + `
+	);
+	CREATE INDEX IF NOT EXISTS idx_task_events_task ON task_events (task_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create activity tables: %w", err)
 	}
 
-	log.Println("Tasks table created/verified successfully")
+	// Task states are stored as the JSON of Task, see audit.go
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		source TEXT NOT NULL,
+		before TEXT,
+		after TEXT,
+		reverted_to INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT ` + nowMillis + `
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_task ON audit_log (task_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create audit log table: %w", err)
+	}
+
+	// The undo journal, see undo.go. It is not included in backups.
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS operations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session TEXT NOT NULL,
+		key TEXT NOT NULL UNIQUE,
+		undone BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at DATETIME DEFAULT ` + nowMillis + `
+	);
+	CREATE INDEX IF NOT EXISTS idx_operations_session ON operations (session, id);
+	CREATE TABLE IF NOT EXISTS operation_tasks (
+		operation_id INTEGER NOT NULL,
+		task_id INTEGER NOT NULL,
+		before TEXT,
+		after TEXT,
+		PRIMARY KEY (operation_id, task_id)
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create undo journal tables: %w", err)
+	}
+
+	// Task templates, see templates.go
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS templates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS template_tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		template_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '', -- Markdown
+		day_of_week TEXT NOT NULL,
+		tags TEXT NOT NULL DEFAULT '',
+		urgent BOOLEAN NOT NULL DEFAULT FALSE,
+		important BOOLEAN NOT NULL DEFAULT FALSE
+	);
+	CREATE INDEX IF NOT EXISTS idx_template_tasks_template ON template_tasks (template_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create template tables: %w", err)
+	}
+
+	// Projects group tasks above tags, see projects.go
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS projects (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		color TEXT NOT NULL DEFAULT '', -- #rrggbb
+		archived BOOLEAN NOT NULL DEFAULT FALSE,
+		target_date TEXT, -- YYYY-MM-DD
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create projects table: %w", err)
+	}
+
+	// API users, see users.go
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the token, hex
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create users table: %w", err)
+	}
 
 	// Run migration to add week_date column if it doesn't exist
 	err = runMigration()
 	if err != nil {
-		log.Fatal("Failed to run migration:", err)
+		return fmt.Errorf("failed to run migration: %w", err)
 	}
 
+	return nil
+}
+
+// newHandler wraps the router in the middleware applied to every request:
+// request logging, CORS, authentication, rate limiting and audit attribution.
+func newHandler(mux http.Handler) http.Handler {
+	c := cors.New(cors.Options{
+		AllowedOrigins:   config.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "X-Requested-With", "Upgrade", "Connection", "Authorization", "X-Request-ID", "X-Zendo-Actor", "X-Zendo-Source", "X-Zendo-Session"},
+		ExposedHeaders:   []string{"X-Request-ID", "Retry-After"},
+		AllowCredentials: true,
+	})
+	return logRequests(c.Handler(authenticate(rateLimit(auditContext(recordRoute(mux)), config.Limits.RequestsPerSecond, config.Limits.Burst))))
+}
+
+// newRouter registers the API routes and the frontend SPA on a new mux.
+func newRouter() (*router, error) {
 	// --- Frontend File Server Setup ---
 	// Create an fs.FS that is rooted at the "static" directory
 	// within the raw embedded filesystem. This makes 'index.html' available at the root.
 	contentFS, err := fs.Sub(rawFSFromEmbed, "static")
 	if err != nil {
-		log.Fatalf("Failed to create sub FS for embedded assets: %v", err)
+		return nil, fmt.Errorf("failed to create sub FS for embedded assets: %w", err)
 	}
 
 	// Wrap the correctly rooted contentFS with our SPA handler logic.
@@ -171,479 +436,517 @@ func main() {
 
 	// --- HTTP Route Handling ---
 	// Create a master router for the application.
-	mux := http.NewServeMux()
+	mux := &router{ServeMux: http.NewServeMux()}
+
+	// Health and build info
+	mux.HandleFunc("GET /healthz", healthz)
+	mux.HandleFunc("GET /readyz", readyz)
+	mux.HandleFunc("GET /api/version", getVersion)
+
+	// API documentation
+	mux.HandleFunc("GET /api/openapi.json", getOpenAPISpec)
+	mux.Handle("GET /api/docs/", apiDocs)
 
 	// API routes
 	mux.HandleFunc("GET /api/tasks", getTasks)
 	mux.HandleFunc("GET /api/tasks/week/{weekDate}", getTasksForWeek)
 	mux.HandleFunc("GET /api/tasks/today", getTasksForToday)
 	mux.HandleFunc("GET /api/tasks/today/week", getTasksForTodayWeek)
-	mux.HandleFunc("POST /api/tasks", createTask)
-	mux.HandleFunc("PUT /api/tasks/{id}", updateTask)
+	mux.HandleFunc("GET /api/tasks/matrix", getTaskMatrix)
+	mux.HandleFunc("POST /api/tasks", limitBody(createTask))
+	mux.HandleFunc("GET /api/tasks/{id}", getTask)
+	mux.HandleFunc("PUT /api/tasks/{id}", limitBody(updateTask))
 	mux.HandleFunc("DELETE /api/tasks/{id}", deleteTask)
+	mux.HandleFunc("POST /api/tasks/bulk", limitBody(bulkTasks))
+	mux.HandleFunc("POST /api/tasks/week/{weekDate}/complete", completeWeek)
+	mux.HandleFunc("DELETE /api/tasks/completed", deleteCompletedTasks)
+	mux.HandleFunc("POST /api/tasks/{id}/move", limitBody(moveTask))
+	mux.HandleFunc("POST /api/tasks/{id}/copy", limitBody(copyTask))
+	mux.HandleFunc("POST /api/tasks/{id}/reorder", limitBody(reorderTask))
+	mux.HandleFunc("POST /api/tasks/week/{weekDate}/copy", limitBody(copyWeek))
+	mux.HandleFunc("POST /api/tasks/week/{weekDate}/template", limitBody(saveWeekAsTemplate))
+	mux.HandleTaskList("attachments", listAttachments)
+	mux.HandleFunc("POST /api/tasks/{id}/attachments", allowSlowUpload(uploadAttachment))
+	mux.HandleFunc("GET /api/tasks/{id}/attachments/{attachmentId}", downloadAttachment)
+	mux.HandleFunc("DELETE /api/tasks/{id}/attachments/{attachmentId}", deleteAttachment)
+	mux.HandleTaskList("comments", listComments)
+	mux.HandleFunc("POST /api/tasks/{id}/comments", limitBody(createComment))
+	mux.HandleFunc("PUT /api/tasks/{id}/comments/{commentId}", limitBody(updateComment))
+	mux.HandleFunc("DELETE /api/tasks/{id}/comments/{commentId}", deleteComment)
+	mux.HandleTaskList("activity", getTaskActivity)
+	mux.HandleTaskList("history", getTaskHistory)
+	mux.HandleFunc("POST /api/tasks/{id}/revert", limitBody(revertTask))
+	mux.HandleFunc("GET /api/audit", getAuditLog)
+	mux.HandleFunc("GET /api/trash", getTrash)
+	mux.HandleFunc("POST /api/undo", undoOperation)
+	mux.HandleFunc("POST /api/redo", redoOperation)
+	mux.HandleFunc("POST /api/tasks/{id}/restore", restoreTask)
+	mux.HandleFunc("GET /api/projects", listProjects)
+	mux.HandleFunc("POST /api/projects", limitBody(createProject))
+	mux.HandleFunc("GET /api/projects/{id}", getProject)
+	mux.HandleFunc("PUT /api/projects/{id}", limitBody(updateProject))
+	mux.HandleFunc("DELETE /api/projects/{id}", deleteProject)
+	mux.HandleFunc("GET /api/templates", listTemplates)
+	mux.HandleFunc("POST /api/templates", limitBody(createTemplate))
+	mux.HandleFunc("GET /api/templates/{id}", getTemplate)
+	mux.HandleFunc("PUT /api/templates/{id}", limitBody(updateTemplate))
+	mux.HandleFunc("DELETE /api/templates/{id}", deleteTemplate)
+	mux.HandleFunc("POST /api/templates/{id}/apply", applyTemplate)
 	mux.HandleFunc("GET /api/debug/timezone", debugTimezone)
 	mux.HandleFunc("GET /api/timezone", getTimezoneInfo)
 	mux.HandleFunc("GET /api/debug/timezones", listTimezones)
+	mux.HandleFunc("GET /api/export/tasks.csv", exportTasksCSV)
+	mux.HandleFunc("GET /api/admin/backup", requireAdmin(backupDatabase))
+	mux.HandleFunc("POST /api/admin/restore", requireAdmin(allowSlowUpload(restoreDatabase)))
+
+	// Metrics are served here unless a separate metrics listener is configured.
+	if config.MetricsListen == "" {
+		mux.HandleFunc("GET /metrics", metricsHandler)
+	}
+
+	// Unknown API paths get a problem instead of the SPA.
+	mux.ServeMux.HandleFunc("/api/", mux.serveUnknownAPI)
 
 	// The root handler serves the frontend SPA.
 	// This must be registered after all other routes to act as a catch-all.
 	mux.Handle("/", fileServer)
 
-	// --- CORS and Server Setup ---
-	// Setup CORS middleware
-	// Get custom app URL from environment variable
-	customAppURL := os.Getenv("APP_URL")
-	
-	// Build allowed origins list
-	allowedOrigins := []string{"http://localhost:5173", "http://localhost:5174", "http://localhost:8080"}
-	if customAppURL != "" {
-		allowedOrigins = append(allowedOrigins, customAppURL)
-		log.Printf("Added custom app URL to CORS: %s", customAppURL)
-	}
-	
-	c := cors.New(cors.Options{
-		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "X-Requested-With", "Upgrade", "Connection"},
-		AllowCredentials: true,
-	})
-
-	// Apply CORS for all routes
-	handler := c.Handler(mux)
-
-	log.Println("Server starting on http://localhost:8080")
-	log.Println("CORS allowed origins:", allowedOrigins)
-	log.Println("API endpoints available:")
-	log.Println("  GET  /api/tasks")
-	log.Println("  GET  /api/tasks/week/{weekDate}")
-	log.Println("  GET  /api/tasks/today")
-	log.Println("  GET  /api/tasks/today/week")
-	log.Println("  POST /api/tasks")
-	log.Println("  PUT  /api/tasks/{id}")
-	log.Println("  DELETE /api/tasks/{id}")
-	log.Println("=== Server ready ===")
-	
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
+	return mux, nil
 }
 
 func getTasks(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== GET /api/tasks - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("User-Agent: %s", r.UserAgent())
-	
-	startTime := time.Now()
-	
-	rows, err := db.Query("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks ORDER BY day_of_week, created_at")
+	logger := requestLogger(r)
+
+	filters, fieldErrors := parseListFilters(r)
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
+	}
+
+	rows, err := db.Query("SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL"+filters.where+" ORDER BY "+filters.orderBy("week_date, day_of_week, position, id"), filters.args...)
 	if err != nil {
-		log.Printf("ERROR: Database query failed: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
 		return
 	}
 	defer rows.Close()
 
 	var tasks []Task
-	taskCount := 0
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt)
+		err := scanTask(rows, &task)
 		if err != nil {
-			log.Printf("ERROR: Row scan failed: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logger.Error("Row scan failed", "error", err)
+			writeInternalError(w, r)
 			return
 		}
 		tasks = append(tasks, task)
-		taskCount++
-		log.Printf("  Task %d: %s (completed: %v, day: %s)", task.ID, task.Title, task.Completed, task.DayOfWeek)
+		logger.Debug("Task", "id", task.ID, "title", task.Title, "completed", task.Completed, "day", task.DayOfWeek)
 	}
 
 	// Always return an array, even if empty
 	if tasks == nil {
 		tasks = []Task{}
 	}
+	if err := renderDescriptions(r, tasks); err != nil {
+		logger.Error("Rendering descriptions failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tasks)
-	
-	duration := time.Since(startTime)
-	log.Printf("=== GET /api/tasks - Response sent ===")
-	log.Printf("Returned %d tasks in %v", taskCount, duration)
+
+	logger.Debug("Returned tasks", "count", len(tasks))
 }
 
 func getTasksForWeek(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== GET /api/tasks/week - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("User-Agent: %s", r.UserAgent())
-	
-	startTime := time.Now()
-	
+	logger := requestLogger(r)
+
 	// Extract weekDate from URL path
-	path := r.URL.Path
-	weekDate := path[len("/api/tasks/week/"):]
-	
-	log.Printf("Fetching tasks for week: %s", weekDate)
-	
-	rows, err := db.Query("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks WHERE week_date = ? ORDER BY day_of_week, created_at", weekDate)
+	weekDate := r.PathValue("weekDate")
+
+	filters, fieldErrors := parseListFilters(r)
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
+	}
+
+	rows, err := db.Query("SELECT "+taskColumns+" FROM tasks WHERE week_date = ? AND deleted_at IS NULL"+filters.where+" ORDER BY "+filters.orderBy("day_of_week, position, id"),
+		append([]interface{}{weekDate}, filters.args...)...)
 	if err != nil {
-		log.Printf("ERROR: Database query failed: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
 		return
 	}
 	defer rows.Close()
 
 	var tasks []Task
-	taskCount := 0
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt)
+		err := scanTask(rows, &task)
 		if err != nil {
-			log.Printf("ERROR: Row scan failed: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logger.Error("Row scan failed", "error", err)
+			writeInternalError(w, r)
 			return
 		}
 		tasks = append(tasks, task)
-		taskCount++
-		log.Printf("  Task %d: %s (completed: %v, day: %s, week: %s)", task.ID, task.Title, task.Completed, task.DayOfWeek, task.WeekDate)
+		logger.Debug("Task", "id", task.ID, "title", task.Title, "completed", task.Completed, "day", task.DayOfWeek, "week", task.WeekDate)
 	}
 
 	// Always return an array, even if empty
 	if tasks == nil {
 		tasks = []Task{}
 	}
+	if err := renderDescriptions(r, tasks); err != nil {
+		logger.Error("Rendering descriptions failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tasks)
-	
-	duration := time.Since(startTime)
-	log.Printf("=== GET /api/tasks/week - Response sent ===")
-	log.Printf("Returned %d tasks for week %s in %v", taskCount, weekDate, duration)
+
+	logger.Debug("Returned tasks for week", "count", len(tasks), "week", weekDate)
+}
+
+// logAllTasks dumps every stored task at debug level, to help diagnose
+// tasks that do not show up for the expected day or week.
+func logAllTasks(r *http.Request, logger *slog.Logger) {
+	if !logger.Enabled(r.Context(), slog.LevelDebug) {
+		return
+	}
+
+	rows, err := db.Query("SELECT id, title, day_of_week, week_date FROM tasks WHERE deleted_at IS NULL ORDER BY week_date, day_of_week")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task Task
+		if err := rows.Scan(&task.ID, &task.Title, &task.DayOfWeek, &task.WeekDate); err == nil {
+			logger.Debug("DB task", "id", task.ID, "title", task.Title, "day", task.DayOfWeek, "week", task.WeekDate)
+		}
+	}
 }
 
 func getTasksForToday(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== GET /api/tasks/today - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("User-Agent: %s", r.UserAgent())
-	
-	startTime := time.Now()
-	
+	logger := requestLogger(r)
+
 	// Get today's date in YYYY-MM-DD format in the configured timezone
 	now := time.Now().In(timezone)
-	today := now.Format("2006-01-02")
 	todayWeekStart := getWeekStart(now).Format("2006-01-02")
-	
-	log.Printf("Server timezone: %s", timezone.String())
-	log.Printf("Current UTC time: %s", time.Now().UTC().Format("2006-01-02 15:04:05"))
-	log.Printf("Current time in configured timezone: %s", now.Format("2006-01-02 15:04:05"))
-	log.Printf("Fetching tasks for today: %s (week: %s)", today, todayWeekStart)
-	
+
 	// Get today's day of week (convert to lowercase to match frontend)
 	todayDayOfWeek := strings.ToLower(now.Weekday().String())
-	
-	log.Printf("Today's day of week: %s", todayDayOfWeek)
-	
-	// Debug: Let's see what tasks exist in the database
-	var allTasks []Task
-	debugRows, err := db.Query("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks ORDER BY week_date, day_of_week")
-	if err == nil {
-		defer debugRows.Close()
-		for debugRows.Next() {
-			var task Task
-			if err := debugRows.Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt); err == nil {
-				allTasks = append(allTasks, task)
-				log.Printf("  DB Task %d: %s (day: %s, week: %s)", task.ID, task.Title, task.DayOfWeek, task.WeekDate)
-			}
-		}
+
+	logger.Debug("Fetching tasks for today",
+		"timezone", timezone.String(),
+		"today", now.Format("2006-01-02"),
+		"week", todayWeekStart,
+		"day", todayDayOfWeek)
+	logAllTasks(r, logger)
+
+	filters, fieldErrors := parseListFilters(r)
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
 	}
-	
-	rows, err := db.Query("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks WHERE week_date = ? AND day_of_week = ? ORDER BY created_at", todayWeekStart, todayDayOfWeek)
+
+	rows, err := db.Query("SELECT "+taskColumns+" FROM tasks WHERE week_date = ? AND day_of_week = ? AND deleted_at IS NULL"+filters.where+" ORDER BY "+filters.orderBy("position, id"),
+		append([]interface{}{todayWeekStart, todayDayOfWeek}, filters.args...)...)
 	if err != nil {
-		log.Printf("ERROR: Database query failed: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
 		return
 	}
 	defer rows.Close()
 
 	var tasks []Task
-	taskCount := 0
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt)
+		err := scanTask(rows, &task)
 		if err != nil {
-			log.Printf("ERROR: Row scan failed: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logger.Error("Row scan failed", "error", err)
+			writeInternalError(w, r)
 			return
 		}
 		tasks = append(tasks, task)
-		taskCount++
-		log.Printf("  Task %d: %s (completed: %v, day: %s, week: %s)", task.ID, task.Title, task.Completed, task.DayOfWeek, task.WeekDate)
+		logger.Debug("Task", "id", task.ID, "title", task.Title, "completed", task.Completed, "day", task.DayOfWeek, "week", task.WeekDate)
 	}
 
 	// Always return an array, even if empty
 	if tasks == nil {
 		tasks = []Task{}
 	}
+	if err := renderDescriptions(r, tasks); err != nil {
+		logger.Error("Rendering descriptions failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tasks)
-	
-	duration := time.Since(startTime)
-	log.Printf("=== GET /api/tasks/today - Response sent ===")
-	log.Printf("Returned %d tasks for today in %v", taskCount, duration)
+
+	logger.Debug("Returned tasks for today", "count", len(tasks))
 }
 
 func getTasksForTodayWeek(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== GET /api/tasks/today/week - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("User-Agent: %s", r.UserAgent())
-	
-	startTime := time.Now()
-	
+	logger := requestLogger(r)
+
 	// Get today's week start date in the configured timezone
 	now := time.Now().In(timezone)
 	todayWeekStart := getWeekStart(now).Format("2006-01-02")
-	
-	log.Printf("Server timezone: %s", timezone.String())
-	log.Printf("Current UTC time: %s", time.Now().UTC().Format("2006-01-02 15:04:05"))
-	log.Printf("Current time in configured timezone: %s", now.Format("2006-01-02 15:04:05"))
-	log.Printf("Fetching tasks for today's week: %s", todayWeekStart)
-	
-	// Debug: Let's see what tasks exist in the database
-	var allTasks []Task
-	debugRows, err := db.Query("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks ORDER BY week_date, day_of_week")
-	if err == nil {
-		defer debugRows.Close()
-		for debugRows.Next() {
-			var task Task
-			if err := debugRows.Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt); err == nil {
-				allTasks = append(allTasks, task)
-				log.Printf("  DB Task %d: %s (day: %s, week: %s)", task.ID, task.Title, task.DayOfWeek, task.WeekDate)
-			}
-		}
+
+	logger.Debug("Fetching tasks for today's week",
+		"timezone", timezone.String(),
+		"today", now.Format("2006-01-02"),
+		"week", todayWeekStart)
+	logAllTasks(r, logger)
+
+	filters, fieldErrors := parseListFilters(r)
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
 	}
-	
-	rows, err := db.Query("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks WHERE week_date = ? ORDER BY day_of_week, created_at", todayWeekStart)
+
+	rows, err := db.Query("SELECT "+taskColumns+" FROM tasks WHERE week_date = ? AND deleted_at IS NULL"+filters.where+" ORDER BY "+filters.orderBy("day_of_week, position, id"),
+		append([]interface{}{todayWeekStart}, filters.args...)...)
 	if err != nil {
-		log.Printf("ERROR: Database query failed: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
 		return
 	}
 	defer rows.Close()
 
 	var tasks []Task
-	taskCount := 0
 	for rows.Next() {
 		var task Task
-		err := rows.Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt)
+		err := scanTask(rows, &task)
 		if err != nil {
-			log.Printf("ERROR: Row scan failed: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logger.Error("Row scan failed", "error", err)
+			writeInternalError(w, r)
 			return
 		}
 		tasks = append(tasks, task)
-		taskCount++
-		log.Printf("  Task %d: %s (completed: %v, day: %s, week: %s)", task.ID, task.Title, task.Completed, task.DayOfWeek, task.WeekDate)
+		logger.Debug("Task", "id", task.ID, "title", task.Title, "completed", task.Completed, "day", task.DayOfWeek, "week", task.WeekDate)
 	}
 
 	// Always return an array, even if empty
 	if tasks == nil {
 		tasks = []Task{}
 	}
+	if err := renderDescriptions(r, tasks); err != nil {
+		logger.Error("Rendering descriptions failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tasks)
-	
-	duration := time.Since(startTime)
-	log.Printf("=== GET /api/tasks/today/week - Response sent ===")
-	log.Printf("Returned %d tasks for today's week in %v", taskCount, duration)
+
+	logger.Debug("Returned tasks for today's week", "count", len(tasks), "week", todayWeekStart)
 }
 
 func createTask(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== POST /api/tasks - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("Content-Type: %s", r.Header.Get("Content-Type"))
-	
-	startTime := time.Now()
-	
+	logger := requestLogger(r)
+
 	var req CreateTaskRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("ERROR: JSON decode failed: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
 		return
 	}
 
-	log.Printf("Request body: title='%s', dayOfWeek='%s', weekDate='%s', tags='%s'", req.Title, req.DayOfWeek, req.WeekDate, req.Tags)
+	logger.Debug("Request body", "title", req.Title, "dayOfWeek", req.DayOfWeek, "weekDate", req.WeekDate, "tags", req.Tags, "urgent", req.Urgent, "important", req.Important)
 
-	if req.Title == "" || req.DayOfWeek == "" || req.WeekDate == "" {
-		log.Printf("ERROR: Missing required fields")
-		http.Error(w, "Title, dayOfWeek, and weekDate are required", http.StatusBadRequest)
+	fields := taskFields{Title: req.Title, Description: req.Description, DayOfWeek: req.DayOfWeek, WeekDate: req.WeekDate, Tags: req.Tags, Urgent: req.Urgent, Important: req.Important, ProjectID: req.ProjectID}
+	fieldErrors := fields.validate()
+	projectErrors, err := checkProject(r.Context(), db, fields.ProjectID)
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if fieldErrors = append(fieldErrors, projectErrors...); len(fieldErrors) > 0 {
+		logger.Warn("Invalid task", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
 		return
 	}
 
-	result, err := db.Exec("INSERT INTO tasks (title, day_of_week, week_date, tags) VALUES (?, ?, ?, ?)", req.Title, req.DayOfWeek, req.WeekDate, req.Tags)
+	task, err := insertTask(r.Context(), db, fields)
 	if err != nil {
-		log.Printf("ERROR: Database insert failed: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database insert failed", "error", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	id, err := result.LastInsertId()
+	logger.Info("Task created", "task_id", task.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(task)
+}
+
+func getTask(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	// Extract ID from URL path
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		log.Printf("ERROR: Failed to get last insert ID: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
 		return
 	}
 
-	log.Printf("Task inserted with ID: %d", id)
-
-	// Fetch the created task
-	var task Task
-	err = db.QueryRow("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks WHERE id = ?", id).
-		Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt)
+	task, err := loadTask(r.Context(), db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR: Failed to fetch created task: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database query failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	log.Printf("Created task: ID=%d, Title='%s', Completed=%v, DayOfWeek='%s', WeekDate='%s', Tags='%s'", 
-		task.ID, task.Title, task.Completed, task.DayOfWeek, task.WeekDate, task.Tags)
+	tasks := []Task{task}
+	if err := renderDescriptions(r, tasks); err != nil {
+		logger.Error("Rendering description failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(task)
-	
-	duration := time.Since(startTime)
-	log.Printf("=== POST /api/tasks - Response sent ===")
-	log.Printf("Task created successfully in %v", duration)
+	json.NewEncoder(w).Encode(tasks[0])
+}
+
+// pathTask reads the task ID from the path and checks that the task
+// exists, writing the problem response when it does not.
+func pathTask(w http.ResponseWriter, r *http.Request) (int, bool) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
+		return 0, false
+	}
+
+	_, err = loadTask(r.Context(), db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
+		return 0, false
+	}
+	if err != nil {
+		logger.Error("Database query failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return 0, false
+	}
+	return id, true
 }
 
 func updateTask(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== PUT /api/tasks - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("Content-Type: %s", r.Header.Get("Content-Type"))
-	
-	startTime := time.Now()
-	
+	logger := requestLogger(r)
+
 	// Extract ID from URL path
-	path := r.URL.Path
-	idStr := path[len("/api/tasks/"):]
+	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		log.Printf("ERROR: Invalid task ID '%s': %v", idStr, err)
-		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
 		return
 	}
 
-	log.Printf("Updating task ID: %d", id)
-
 	var req UpdateTaskRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("ERROR: JSON decode failed: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
 		return
 	}
 
-	log.Printf("Request body: title='%s', completed=%v, dayOfWeek='%s', weekDate='%s', tags='%s'", 
-		req.Title, req.Completed, req.DayOfWeek, req.WeekDate, req.Tags)
+	logger.Debug("Request body", "task_id", id, "title", req.Title, "completed", req.Completed, "dayOfWeek", req.DayOfWeek, "weekDate", req.WeekDate, "tags", req.Tags, "urgent", req.Urgent, "important", req.Important)
 
-	// First, let's check what the current state is
-	var currentTask Task
-	err = db.QueryRow("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks WHERE id = ?", id).
-		Scan(&currentTask.ID, &currentTask.Title, &currentTask.Completed, &currentTask.DayOfWeek, &currentTask.WeekDate, &currentTask.Tags, &currentTask.CreatedAt, &currentTask.UpdatedAt)
+	fields := taskFields{Title: req.Title, Description: req.Description, DayOfWeek: req.DayOfWeek, WeekDate: req.WeekDate, Tags: req.Tags, Urgent: req.Urgent, Important: req.Important, ProjectID: req.ProjectID}
+	fieldErrors := fields.validate()
+	projectErrors, err := checkProject(r.Context(), db, fields.ProjectID)
 	if err != nil {
-		log.Printf("ERROR: Failed to fetch current task state: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
 		return
 	}
-
-	log.Printf("Current task state: ID=%d, Title='%s', Completed=%v, DayOfWeek='%s', WeekDate='%s', Tags='%s'", 
-		currentTask.ID, currentTask.Title, currentTask.Completed, currentTask.DayOfWeek, currentTask.WeekDate, currentTask.Tags)
-
-	// Perform the update
-	_, err = db.Exec("UPDATE tasks SET title = ?, completed = ?, day_of_week = ?, week_date = ?, tags = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", 
-		req.Title, req.Completed, req.DayOfWeek, req.WeekDate, req.Tags, id)
-	if err != nil {
-		log.Printf("ERROR: Database update failed: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if fieldErrors = append(fieldErrors, projectErrors...); len(fieldErrors) > 0 {
+		logger.Warn("Invalid task", "task_id", id, "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
 		return
 	}
 
-	log.Printf("Database update completed successfully")
-
-	// Fetch the updated task
-	var task Task
-	err = db.QueryRow("SELECT id, title, completed, day_of_week, week_date, tags, created_at, updated_at FROM tasks WHERE id = ?", id).
-		Scan(&task.ID, &task.Title, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.CreatedAt, &task.UpdatedAt)
+	task, err := saveTask(r.Context(), db, id, fields, req.Completed)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR: Failed to fetch updated task: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Database update failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	log.Printf("Updated task: ID=%d, Title='%s', Completed=%v, DayOfWeek='%s', WeekDate='%s', Tags='%s'", 
-		task.ID, task.Title, task.Completed, task.DayOfWeek, task.WeekDate, task.Tags)
+	logger.Info("Task updated", "task_id", task.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(task)
-	
-	duration := time.Since(startTime)
-	log.Printf("=== PUT /api/tasks - Response sent ===")
-	log.Printf("Task updated successfully in %v", duration)
 }
 
 func deleteTask(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== DELETE /api/tasks - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	
-	startTime := time.Now()
-	
+	logger := requestLogger(r)
+
 	// Extract ID from URL path
-	path := r.URL.Path
-	idStr := path[len("/api/tasks/"):]
+	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		log.Printf("ERROR: Invalid task ID '%s': %v", idStr, err)
-		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
 		return
 	}
 
-	log.Printf("Deleting task ID: %d", id)
-
-	result, err := db.Exec("DELETE FROM tasks WHERE id = ?", id)
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("ERROR: Database delete failed: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("ERROR: Failed to get rows affected: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	err = removeTask(r.Context(), tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
 		return
 	}
-
-	if rowsAffected == 0 {
-		log.Printf("ERROR: Task not found (ID: %d)", id)
-		http.Error(w, "Task not found", http.StatusNotFound)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Database delete failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	log.Printf("Task deleted successfully (ID: %d, rows affected: %d)", id, rowsAffected)
+	logger.Info("Task moved to trash", "task_id", id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Task deleted successfully"})
-	
-	duration := time.Since(startTime)
-	log.Printf("=== DELETE /api/tasks - Response sent ===")
-	log.Printf("Task deleted successfully in %v", duration)
 }
 
 // runMigration handles database schema migrations
 func runMigration() error {
-	log.Println("=== Running Database Migration ===")
-
 	// Check if week_date column exists
 	var columnExists int
 	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('tasks') WHERE name='week_date'").Scan(&columnExists)
@@ -652,8 +955,8 @@ func runMigration() error {
 	}
 
 	if columnExists == 0 {
-		log.Println("Adding week_date column to tasks table...")
-		
+		slog.Info("Adding week_date column to tasks table")
+
 		// Add the new column
 		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN week_date TEXT")
 		if err != nil {
@@ -664,17 +967,13 @@ func runMigration() error {
 		now := time.Now().In(timezone)
 		weekStart := getWeekStart(now)
 		weekDate := weekStart.Format("2006-01-02")
-		
-		log.Printf("Updating existing tasks with default week date: %s", weekDate)
-		
+
+		slog.Info("Updating existing tasks with default week date", "week", weekDate)
+
 		_, err = db.Exec("UPDATE tasks SET week_date = ? WHERE week_date IS NULL", weekDate)
 		if err != nil {
 			return err
 		}
-
-		log.Println("Migration completed successfully!")
-	} else {
-		log.Println("week_date column already exists. No migration needed.")
 	}
 
 	// Check if tags column exists
@@ -685,8 +984,8 @@ func runMigration() error {
 	}
 
 	if tagsColumnExists == 0 {
-		log.Println("Adding tags column to tasks table...")
-		
+		slog.Info("Adding tags column to tasks table")
+
 		// Add the new column
 		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN tags TEXT")
 		if err != nil {
@@ -694,91 +993,159 @@ func runMigration() error {
 		}
 
 		// Update existing tasks with default tags (empty string)
-		log.Printf("Updating existing tasks with default tags: ''")
-		
 		_, err = db.Exec("UPDATE tasks SET tags = '' WHERE tags IS NULL")
 		if err != nil {
 			return err
 		}
+	}
+
+	// Check if position column exists
+	var positionColumnExists int
+	err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('tasks') WHERE name='position'").Scan(&positionColumnExists)
+	if err != nil {
+		return err
+	}
+
+	if positionColumnExists == 0 {
+		slog.Info("Adding position column to tasks table")
+
+		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN position TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+
+		// Existing tasks keep their creation order within each day
+		days, err := assignMissingPositions(context.Background(), db)
+		if err != nil {
+			return err
+		}
+		slog.Info("Assigned task positions", "days", days)
+	}
+
+	// Check if the priority columns exist
+	var urgentColumnExists int
+	err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('tasks') WHERE name='urgent'").Scan(&urgentColumnExists)
+	if err != nil {
+		return err
+	}
+
+	if urgentColumnExists == 0 {
+		slog.Info("Adding urgent and important columns to tasks table")
+
+		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN urgent BOOLEAN NOT NULL DEFAULT FALSE")
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN important BOOLEAN NOT NULL DEFAULT FALSE")
+		if err != nil {
+			return err
+		}
+	}
 
-		log.Println("Migration completed successfully!")
-	} else {
-		log.Println("tags column already exists. No migration needed.")
+	// Check if description column exists
+	var descriptionColumnExists int
+	err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('tasks') WHERE name='description'").Scan(&descriptionColumnExists)
+	if err != nil {
+		return err
 	}
 
+	if descriptionColumnExists == 0 {
+		slog.Info("Adding description column to tasks table")
+
+		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN description TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check if deleted_at column exists
+	var deletedAtColumnExists int
+	err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('tasks') WHERE name='deleted_at'").Scan(&deletedAtColumnExists)
+	if err != nil {
+		return err
+	}
+
+	if deletedAtColumnExists == 0 {
+		slog.Info("Adding deleted_at column to tasks table")
+
+		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN deleted_at DATETIME")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check if project_id column exists
+	var projectColumnExists int
+	err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('tasks') WHERE name='project_id'").Scan(&projectColumnExists)
+	if err != nil {
+		return err
+	}
+
+	if projectColumnExists == 0 {
+		slog.Info("Adding project_id column to tasks table")
+
+		_, err = db.Exec("ALTER TABLE tasks ADD COLUMN project_id INTEGER")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_tasks_project ON tasks (project_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_tasks_deleted_at ON tasks (deleted_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_tasks_day_position ON tasks (week_date, day_of_week, position)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Database migrations applied", "schema_version", schemaVersion)
 	return nil
 }
 
-// getWeekStart returns the Sunday of the current week
+// getWeekStart returns the Sunday of the week containing date. Weeks always start
+// on Sunday: stored week dates and the web app both rely on it.
 func getWeekStart(date time.Time) time.Time {
 	weekday := date.Weekday()
 	return date.AddDate(0, 0, -int(weekday))
 }
 
 func debugTimezone(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== GET /api/debug/timezone - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("User-Agent: %s", r.UserAgent())
-
-	startTime := time.Now()
-
 	now := time.Now()
-	
-	log.Printf("Current UTC time: %s", now.UTC().Format("2006-01-02 15:04:05"))
-	log.Printf("Current time in configured timezone: %s", now.In(timezone).Format("2006-01-02 15:04:05"))
-	log.Printf("Current time in local timezone: %s", now.Local().Format("2006-01-02 15:04:05"))
-	log.Printf("Timezone offset from UTC: %s", now.In(timezone).Format("-07:00"))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"current_utc_time": now.UTC().Format("2006-01-02 15:04:05"),
+		"current_utc_time":   now.UTC().Format("2006-01-02 15:04:05"),
 		"current_local_time": now.In(timezone).Format("2006-01-02 15:04:05"),
-		"timezone_offset": now.In(timezone).Format("-07:00"),
+		"timezone_offset":    now.In(timezone).Format("-07:00"),
 	})
-
-	duration := time.Since(startTime)
-	log.Printf("=== GET /api/debug/timezone - Response sent ===")
-	log.Printf("Returned debug info in %v", duration)
 }
 
 func getTimezoneInfo(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== GET /api/timezone - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("User-Agent: %s", r.UserAgent())
-
-	startTime := time.Now()
-
 	now := time.Now()
-	
-	log.Printf("Current UTC time: %s", now.UTC().Format("2006-01-02 15:04:05"))
-	log.Printf("Current time in configured timezone: %s", now.In(timezone).Format("2006-01-02 15:04:05"))
-	log.Printf("Timezone offset from UTC: %s", now.In(timezone).Format("-07:00"))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"current_utc_time": now.UTC().Format("2006-01-02 15:04:05"),
+		"current_utc_time":   now.UTC().Format("2006-01-02 15:04:05"),
 		"current_local_time": now.In(timezone).Format("2006-01-02 15:04:05"),
-		"timezone_offset": now.In(timezone).Format("-07:00"),
+		"timezone_offset":    now.In(timezone).Format("-07:00"),
 	})
-
-	duration := time.Since(startTime)
-	log.Printf("=== GET /api/timezone - Response sent ===")
-	log.Printf("Returned timezone info in %v", duration)
 }
 
 func listTimezones(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== GET /api/debug/timezones - Request received ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("User-Agent: %s", r.UserAgent())
-
-	startTime := time.Now()
-
 	timezones := time.Now().Location().String()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"timezones": timezones})
-
-	duration := time.Since(startTime)
-	log.Printf("=== GET /api/debug/timezones - Response sent ===")
-	log.Printf("Returned timezones in %v", duration)
-}
\ No newline at end of file
+}
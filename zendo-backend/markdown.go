@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Checklist counts the "- [ ]" and "- [x]" items of a task description.
+type Checklist struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+var checklistItem = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+\[([ xX])\](?:\s|$)`)
+
+// eachChecklistItem calls fn with the index of every checklist item among
+// lines and the bounds of its check mark, skipping fenced code blocks.
+func eachChecklistItem(lines []string, fn func(i, markStart, markEnd int)) {
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if loc := checklistItem.FindStringSubmatchIndex(line); loc != nil {
+			fn(i, loc[2], loc[3])
+		}
+	}
+}
+
+// countChecklist counts the checklist items of a Markdown description.
+func countChecklist(description string) Checklist {
+	var checklist Checklist
+	lines := strings.Split(description, "\n")
+	eachChecklistItem(lines, func(i, markStart, markEnd int) {
+		checklist.Total++
+		if lines[i][markStart:markEnd] != " " {
+			checklist.Done++
+		}
+	})
+	return checklist
+}
+
+// resetChecklist unchecks every checklist item of a Markdown description.
+func resetChecklist(description string) string {
+	lines := strings.Split(description, "\n")
+	eachChecklistItem(lines, func(i, markStart, markEnd int) {
+		lines[i] = lines[i][:markStart] + " " + lines[i][markEnd:]
+	})
+	return strings.Join(lines, "\n")
+}
+
+// markdown renders GitHub Flavored Markdown. Raw HTML in the source is
+// omitted by goldmark and the output is sanitized again below.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// htmlPolicy allows the usual user-generated content plus the disabled
+// checkboxes goldmark renders for task list items.
+var htmlPolicy = func() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	policy.RequireNoReferrerOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+	return policy
+}()
+
+// renderMarkdown returns the sanitized HTML for a Markdown description.
+func renderMarkdown(source string) (string, error) {
+	if source == "" {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return htmlPolicy.Sanitize(buf.String()), nil
+}
+
+// wantsHTML reports whether the client asked for rendered descriptions
+// with ?render=html.
+func wantsHTML(r *http.Request) bool {
+	return r.URL.Query().Get("render") == "html"
+}
+
+// renderDescriptions fills in DescriptionHTML when the client asked for it.
+func renderDescriptions(r *http.Request, tasks []Task) error {
+	if !wantsHTML(r) {
+		return nil
+	}
+	for i := range tasks {
+		html, err := renderMarkdown(tasks[i].Description)
+		if err != nil {
+			return err
+		}
+		tasks[i].DescriptionHTML = html
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCountChecklist(t *testing.T) {
+	description := "Notes\n- [x] draft\n- [ ] review\n  * [X] nested\n1. [ ] numbered\n- [] not an item\n```\n- [ ] in code\n```\n- [ ]"
+	if got, want := countChecklist(description), (Checklist{Done: 2, Total: 5}); got != want {
+		t.Errorf("countChecklist = %+v, want %+v", got, want)
+	}
+}
+
+func TestResetChecklist(t *testing.T) {
+	description := "- [x] draft\n  * [X] nested\n```\n- [x] in code\n```\n1. [ ] open"
+	if got, want := resetChecklist(description), "- [ ] draft\n  * [ ] nested\n```\n- [x] in code\n```\n1. [ ] open"; got != want {
+		t.Errorf("resetChecklist = %q, want %q", got, want)
+	}
+}
+
+func TestDescriptionEndpoints(t *testing.T) {
+	c := newTestClient(t)
+	c.call("POST", "/api/tasks", `{"title":"Plan","description":"Call **Dana** about the budget\n\n- [x] agenda\n- [ ] notes","dayOfWeek":"monday","weekDate":"2024-01-07","urgent":true,"important":true}`)
+	c.call("POST", "/api/tasks", `{"title":"Review","description":"Read the Budget draft","dayOfWeek":"tuesday","weekDate":"2024-01-07"}`)
+	c.call("POST", "/api/tasks", `{"title":"Ship","tags":"budget","dayOfWeek":"wednesday","weekDate":"2024-01-07"}`)
+
+	// HTML is only rendered on request, for single tasks and lists alike.
+	for _, path := range []string{"/api/tasks/1", "/api/tasks/week/2024-01-07", "/api/tasks/matrix?week=2024-01-07"} {
+		_, data := c.call("GET", path, "")
+		if strings.Contains(string(data), "descriptionHtml") {
+			t.Errorf("GET %s without render: %s", path, data)
+		}
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		status, data := c.call("GET", path+sep+"render=html", "")
+		var body any
+		c.decode(data, &body)
+		if got := fmt.Sprint(body); status != 200 || !strings.Contains(got, "<strong>Dana</strong>") || !strings.Contains(got, `type="checkbox"`) {
+			t.Errorf("GET %s with render=html: status %d, body %s", path, status, data)
+		}
+	}
+	if task := c.task(1); task.Checklist != (Checklist{Done: 1, Total: 2}) {
+		t.Errorf("checklist = %+v, want 1 of 2 done", task.Checklist)
+	}
+
+	// Every word of q must match the title, description or tags, ignoring case.
+	for query, want := range map[string]string{
+		"budget":         "Plan,Review,Ship",
+		"dana":           "Plan",
+		"budget%20draft": "Review",
+		"read%20budget":  "Review",
+		"%25":            "", // a literal percent sign, not a wildcard
+	} {
+		if got := c.titles("/api/tasks/week/2024-01-07?q=" + query); got != want {
+			t.Errorf("q=%s = %s, want %s", query, got, want)
+		}
+	}
+	if got := c.titles("/api/tasks?q=agenda"); got != "Plan" {
+		t.Errorf("all tasks with q=agenda = %s, want Plan", got)
+	}
+}
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	html, err := renderMarkdown("- [x] done\n\n<script>alert(1)</script>\n\n[link](javascript:alert(1)) <img src=x onerror=alert(1)> **bold**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, forbidden := range []string{"<script", "javascript:", "onerror"} {
+		if strings.Contains(html, forbidden) {
+			t.Errorf("rendered HTML contains %q:\n%s", forbidden, html)
+		}
+	}
+	for _, wanted := range []string{`<input checked="" disabled="" type="checkbox"`, "<strong>bold</strong>"} {
+		if !strings.Contains(html, wanted) {
+			t.Errorf("rendered HTML lacks %q:\n%s", wanted, html)
+		}
+	}
+}
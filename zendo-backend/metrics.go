@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics are exposed at /metrics in the Prometheus text exposition format.
+// The handful of metrics Zendo needs are implemented here directly rather
+// than pulling in the Prometheus client library.
+
+// defaultBuckets are the histogram upper bounds in seconds.
+var defaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// counterVec is a counter partitioned by label values.
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	c.add(1, labelValues...)
+}
+
+func (c *counterVec) add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key, "", ""), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram partitioned by label values.
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: defaultBuckets, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, "", ""), s.count)
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels renders the label set encoded in key, plus an optional extra label.
+func formatLabels(names []string, key, extraName, extraValue string) string {
+	var pairs []string
+	if len(names) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, name := range names {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", name, escapeLabelValue(values[i])))
+		}
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue drops characters that %q would escape differently from
+// the exposition format; label values here are routes, methods and codes.
+func escapeLabelValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	httpRequestsTotal = newCounterVec("zendo_http_requests_total",
+		"Total HTTP requests by method, route pattern and status code.", "method", "route", "status")
+	httpRequestDuration = newHistogramVec("zendo_http_request_duration_seconds",
+		"HTTP request latency by method and route pattern.", "method", "route")
+	dbQueryDuration = newHistogramVec("zendo_db_query_duration_seconds",
+		"SQLite statement latency by operation.", "operation")
+	dbQueryErrorsTotal = newCounterVec("zendo_db_query_errors_total",
+		"SQLite statements that returned an error, by operation.", "operation")
+	backupRunsTotal = newCounterVec("zendo_backup_runs_total",
+		"Scheduled backup runs by result.", "result")
+	trashPurgeRunsTotal = newCounterVec("zendo_trash_purge_runs_total",
+		"Trash purge runs by result.", "result")
+	trashPurgedTasksTotal = newCounterVec("zendo_trash_purged_tasks_total",
+		"Tasks permanently deleted from the trash after the retention period.")
+)
+
+// observeHTTPRequest records a finished request. It is called by logRequests.
+func observeHTTPRequest(method, route string, status int, duration time.Duration) {
+	httpRequestsTotal.inc(method, route, strconv.Itoa(status))
+	httpRequestDuration.observe(duration.Seconds(), method, route)
+}
+
+// metricsHandler serves all metrics. Task gauges are computed on each scrape.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	httpRequestsTotal.write(w)
+	httpRequestDuration.write(w)
+	dbQueryDuration.write(w)
+	dbQueryErrorsTotal.write(w)
+	backupRunsTotal.write(w)
+	trashPurgeRunsTotal.write(w)
+	trashPurgedTasksTotal.write(w)
+
+	var total, open int
+	err := db.QueryRowContext(r.Context(), "SELECT COUNT(*), COALESCE(SUM(CASE WHEN completed THEN 0 ELSE 1 END), 0) FROM tasks WHERE deleted_at IS NULL").Scan(&total, &open)
+	if err != nil {
+		requestLogger(r).Error("Failed to count tasks for metrics", "error", err)
+	} else {
+		fmt.Fprintf(w, "# HELP zendo_tasks_total Number of stored tasks.\n# TYPE zendo_tasks_total gauge\nzendo_tasks_total %d\n", total)
+		fmt.Fprintf(w, "# HELP zendo_tasks_open Number of tasks not yet completed.\n# TYPE zendo_tasks_open gauge\nzendo_tasks_open %d\n", open)
+	}
+
+	stats := db.Stats()
+	fmt.Fprintf(w, "# HELP zendo_db_open_connections Open SQLite connections.\n# TYPE zendo_db_open_connections gauge\nzendo_db_open_connections %d\n", stats.OpenConnections)
+}
+
+// instrumentedDriverName is the database/sql driver used to open the database.
+// It wraps the SQLite driver to record statement latency and errors.
+const instrumentedDriverName = "sqlite-instrumented"
+
+func init() {
+	// sql.Open does not connect; it only looks up the registered SQLite driver.
+	base, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register(instrumentedDriverName, instrumentedDriver{base.Driver()})
+	base.Close()
+}
+
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+// instrumentedConn times statements executed directly on the connection,
+// which is how database/sql runs Exec and Query for this driver.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+// sqlOperation returns the leading SQL keyword, used as a low cardinality label.
+func sqlOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete", "create", "alter", "pragma":
+		return op
+	}
+	return "other"
+}
+
+func observeQuery(query string, start time.Time, err error) {
+	op := sqlOperation(query)
+	dbQueryDuration.observe(time.Since(start).Seconds(), op)
+	if err != nil && err != driver.ErrSkip {
+		dbQueryErrorsTotal.inc(op)
+	}
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	observeQuery(query, start, err)
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	observeQuery(query, start, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
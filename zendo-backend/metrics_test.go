@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// counterValue returns the value of one series of a counter.
+func counterValue(c *counterVec, labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func TestMetricsExposition(t *testing.T) {
+	counter := newCounterVec("test_requests_total", "Requests by route.", "method", "route")
+	counter.inc("GET", "/api/tasks/{id}")
+	counter.add(2, "GET", "/api/tasks/{id}")
+	counter.inc("POST", `say "hi"\n`)
+
+	histogram := newHistogramVec("test_duration_seconds", "Latency.", "route")
+	histogram.buckets = []float64{.1, 1}
+	histogram.observe(.05, "a")
+	histogram.observe(.5, "a")
+	histogram.observe(3, "a")
+
+	var buf strings.Builder
+	counter.write(&buf)
+	histogram.write(&buf)
+	want := `# HELP test_requests_total Requests by route.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",route="/api/tasks/{id}"} 3
+test_requests_total{method="POST",route="say \"hi\"\\n"} 1
+# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="a",le="0.1"} 1
+test_duration_seconds_bucket{route="a",le="1"} 2
+test_duration_seconds_bucket{route="a",le="+Inf"} 3
+test_duration_seconds_sum{route="a"} 3.55
+test_duration_seconds_count{route="a"} 3
+`
+	if buf.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	c := newTestClient(t)
+	c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	resp, err := http.Get(c.server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\nzendo_tasks_total 1\n",
+		"\nzendo_tasks_open 1\n",
+		"\nzendo_db_query_duration_seconds_bucket{operation=\"insert\",le=\"+Inf\"} ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+	// Every sample line belongs to a family announced by a TYPE line.
+	var family string
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			family = strings.Fields(name)[0]
+			continue
+		}
+		if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, family) {
+			t.Errorf("sample %q outside its family %s", line, family)
+		}
+	}
+}
+
+func TestTrashPurgeMetrics(t *testing.T) {
+	c := newTestClient(t)
+
+	for _, title := range []string{"A", "B"} {
+		_, data := c.call("POST", "/api/tasks", fmt.Sprintf(`{"title":%q,"dayOfWeek":"monday","weekDate":"2024-01-07"}`, title))
+		var task Task
+		c.decode(data, &task)
+		c.call("DELETE", fmt.Sprintf("/api/tasks/%d", task.ID), "")
+	}
+
+	runs, purged := counterValue(trashPurgeRunsTotal, "success"), counterValue(trashPurgedTasksTotal)
+	runTrashPurge(context.Background(), time.Now().Add(time.Second))
+	if got := counterValue(trashPurgeRunsTotal, "success") - runs; got != 1 {
+		t.Errorf("successful purge runs increased by %g, want 1", got)
+	}
+	if got := counterValue(trashPurgedTasksTotal) - purged; got != 2 {
+		t.Errorf("purged tasks increased by %g, want 2", got)
+	}
+
+	_, data := c.call("GET", "/metrics", "")
+	for _, want := range []string{
+		"# TYPE zendo_trash_purge_runs_total counter\n",
+		"\nzendo_trash_purge_runs_total{result=\"success\"} ",
+		"\nzendo_trash_purged_tasks_total ",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Copy scopes. A task copy duplicates one task; day and week copies
+// duplicate every task in the task's day or week, keeping their order.
+const (
+	scopeTask = "task"
+	scopeDay  = "day"
+	scopeWeek = "week"
+)
+
+// MoveTaskRequest is the body of POST /api/tasks/{id}/move. The destination
+// is either absolute, with dayOfWeek and/or weekDate (a missing one keeps the
+// task's current value), or relative to the task's current date.
+type MoveTaskRequest struct {
+	DayOfWeek string `json:"dayOfWeek,omitempty"`
+	WeekDate  string `json:"weekDate,omitempty"`
+	Relative  string `json:"relative,omitempty"`
+}
+
+// CopyTaskRequest is the body of POST /api/tasks/{id}/copy. The destination
+// is given as for a move; Scope is task (the default), day or week.
+type CopyTaskRequest struct {
+	DayOfWeek string `json:"dayOfWeek,omitempty"`
+	WeekDate  string `json:"weekDate,omitempty"`
+	Relative  string `json:"relative,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+// CopyWeekRequest is the body of POST /api/tasks/week/{weekDate}/copy. The
+// destination week is a date in it, or relative to the source week.
+type CopyWeekRequest struct {
+	WeekDate string `json:"weekDate,omitempty"`
+	Relative string `json:"relative,omitempty"`
+}
+
+// taskTarget is the destination of a move or copy.
+type taskTarget struct {
+	DayOfWeek string
+	WeekDate  string
+	Relative  string
+}
+
+// maxRelativeDays bounds relative offsets to keep dates in a sane range.
+const maxRelativeDays = 3660
+
+var relativeDatePattern = regexp.MustCompile(`^([+-]?\d{1,5})\s*(d|days?|w|weeks?)$`)
+
+var relativeDateWords = map[string]int{
+	"tomorrow":      1,
+	"next day":      1,
+	"yesterday":     -1,
+	"previous day":  -1,
+	"next week":     7,
+	"last week":     -7,
+	"previous week": -7,
+}
+
+// parseRelativeDays turns "+1 day", "-2 weeks", "3d", "tomorrow" or
+// "next week" into a number of days.
+func parseRelativeDays(s string) (int, bool) {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	if days, ok := relativeDateWords[s]; ok {
+		return days, true
+	}
+	m := relativeDatePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	days, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	if strings.HasPrefix(m[2], "w") {
+		days *= 7
+	}
+	if days > maxRelativeDays || days < -maxRelativeDays {
+		return 0, false
+	}
+	return days, true
+}
+
+// resolveTarget returns the date a task moves or is copied to.
+func resolveTarget(task *Task, target taskTarget) (time.Time, []FieldError) {
+	if target.Relative != "" {
+		if target.DayOfWeek != "" || target.WeekDate != "" {
+			return time.Time{}, []FieldError{{Field: "relative", Code: fieldInvalid, Message: "cannot be combined with dayOfWeek or weekDate"}}
+		}
+		days, ok := parseRelativeDays(target.Relative)
+		if !ok {
+			return time.Time{}, []FieldError{{Field: "relative", Code: fieldInvalid, Message: "must be an offset such as \"+1 day\", \"-2 weeks\", \"tomorrow\" or \"next week\""}}
+		}
+		from, ok := taskDate(task)
+		if !ok {
+			return time.Time{}, []FieldError{{Field: "relative", Code: fieldInvalid, Message: "the task has no valid date to start from, give dayOfWeek and weekDate instead"}}
+		}
+		return from.AddDate(0, 0, days), nil
+	}
+
+	if target.DayOfWeek == "" && target.WeekDate == "" {
+		return time.Time{}, []FieldError{{Field: "dayOfWeek", Code: fieldRequired, Message: "dayOfWeek, weekDate or relative is required"}}
+	}
+	var fieldErrors []FieldError
+	dest := Task{DayOfWeek: task.DayOfWeek, WeekDate: task.WeekDate}
+	if target.DayOfWeek != "" {
+		if day, ok := normalizeDayOfWeek(target.DayOfWeek); ok {
+			dest.DayOfWeek = day
+		} else {
+			fieldErrors = append(fieldErrors, FieldError{Field: "dayOfWeek", Code: fieldInvalid, Message: "must be a day name such as \"tuesday\" or \"Tue\", or a number from 0 (Sunday) to 6"})
+		}
+	}
+	if target.WeekDate != "" {
+		if week, ok := normalizeWeekDate(target.WeekDate); ok {
+			dest.WeekDate = week
+		} else {
+			fieldErrors = append(fieldErrors, FieldError{Field: "weekDate", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return time.Time{}, fieldErrors
+	}
+	date, ok := taskDate(&dest)
+	if !ok {
+		return time.Time{}, []FieldError{{Field: "dayOfWeek", Code: fieldInvalid, Message: "the task has no valid date, give both dayOfWeek and weekDate"}}
+	}
+	return date, nil
+}
+
+// daysBetween counts the calendar days from one date to another, ignoring
+// daylight saving changes.
+func daysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// scheduleOn points fields at the day and week of date.
+func (f *taskFields) scheduleOn(date time.Time) {
+	f.DayOfWeek = daysOfWeek[date.Weekday()]
+	f.WeekDate = getWeekStart(date).Format("2006-01-02")
+}
+
+// moveTaskTo reschedules a task. Problems with the target are returned as
+// field errors; the error is sql.ErrNoRows when the task does not exist.
+func moveTaskTo(ctx context.Context, q queryer, id int, target taskTarget) (Task, []FieldError, error) {
+	task, err := loadTask(ctx, q, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	date, fieldErrors := resolveTarget(&task, target)
+	if len(fieldErrors) > 0 {
+		return Task{}, fieldErrors, nil
+	}
+	fields := fieldsOf(&task)
+	fields.scheduleOn(date)
+	if fieldErrors := fields.normalize(); len(fieldErrors) > 0 {
+		return Task{}, fieldErrors, nil
+	}
+	task, err = saveTask(ctx, q, id, fields, task.Completed)
+	return task, nil, err
+}
+
+// undatedTasks rejects a copy of tasks whose day and week do not form a
+// date, such as rows written before validation existed, as they cannot be
+// shifted.
+func undatedTasks(field string, tasks []Task) []FieldError {
+	var ids []string
+	for _, task := range tasks {
+		if _, ok := taskDate(&task); !ok {
+			ids = append(ids, strconv.Itoa(task.ID))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return []FieldError{{Field: field, Code: fieldInvalid, Message: "tasks " + strings.Join(ids, ", ") + " have no valid date to copy from, fix them or run zendo repair"}}
+}
+
+// copyTasks inserts open copies of tasks shifted by the given number of
+// days, with their checklists unchecked as when a template is applied.
+// Tasks are inserted in order, so copies keep their relative order in the
+// destination day and follow the tasks already there. Every task must have
+// a valid date; see undatedTasks.
+func copyTasks(ctx context.Context, q queryer, tasks []Task, days int) ([]Task, error) {
+	copies := make([]Task, 0, len(tasks))
+	for _, task := range tasks {
+		date, _ := taskDate(&task)
+		fields := fieldsOf(&task)
+		fields.Description = resetChecklist(fields.Description)
+		fields.scheduleOn(date.AddDate(0, 0, days))
+		duplicate, err := insertTask(ctx, q, fields)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, duplicate)
+	}
+	return copies, nil
+}
+
+func moveTask(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
+		return
+	}
+
+	var req MoveTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	task, fieldErrors, err := moveTaskTo(r.Context(), tx, id, taskTarget{DayOfWeek: req.DayOfWeek, WeekDate: req.WeekDate, Relative: req.Relative})
+	if err == nil && len(fieldErrors) == 0 {
+		err = tx.Commit()
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Database update failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		logger.Warn("Invalid move target", "task_id", id, "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	logger.Info("Task moved", "task_id", id, "week", task.WeekDate, "day", task.DayOfWeek)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+func copyTask(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
+		return
+	}
+
+	var req CopyTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = scopeTask
+	}
+	if req.Scope != scopeTask && req.Scope != scopeDay && req.Scope != scopeWeek {
+		writeValidationError(w, r, []FieldError{{Field: "scope", Code: fieldInvalid, Message: "must be task, day or week"}})
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	copies, fieldErrors, err := copyTaskScope(r.Context(), tx, id, req)
+	if err == nil && len(fieldErrors) == 0 {
+		err = tx.Commit()
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Database insert failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		logger.Warn("Invalid copy target", "task_id", id, "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	logger.Info("Task copied", "task_id", id, "scope", req.Scope, "copies", len(copies))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(copies)
+}
+
+// copyTaskScope copies a task, or every task of its day or week, to the
+// destination of req.
+func copyTaskScope(ctx context.Context, q queryer, id int, req CopyTaskRequest) ([]Task, []FieldError, error) {
+	task, err := loadTask(ctx, q, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	date, fieldErrors := resolveTarget(&task, taskTarget{DayOfWeek: req.DayOfWeek, WeekDate: req.WeekDate, Relative: req.Relative})
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors, nil
+	}
+	from, ok := taskDate(&task)
+	if !ok {
+		return nil, undatedTasks("scope", []Task{task}), nil
+	}
+
+	var tasks []Task
+	days := daysBetween(from, date)
+	switch req.Scope {
+	case scopeTask:
+		tasks = []Task{task}
+	case scopeDay:
+		tasks, err = queryTasks(ctx, q, "week_date = ? AND day_of_week = ?", task.WeekDate, task.DayOfWeek)
+	case scopeWeek:
+		// Whole weeks keep every task on its weekday.
+		tasks, err = queryTasks(ctx, q, "week_date = ?", task.WeekDate)
+		days = daysBetween(getWeekStart(from), getWeekStart(date))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if fieldErrors := undatedTasks("scope", tasks); len(fieldErrors) > 0 {
+		return nil, fieldErrors, nil
+	}
+	copies, err := copyTasks(ctx, q, tasks, days)
+	return copies, nil, err
+}
+
+// copyWeek duplicates every task of a week into another week, for
+// example to reuse a template week.
+func copyWeek(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	weekDate, ok := normalizeWeekDate(r.PathValue("weekDate"))
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid path parameter",
+			FieldError{Field: "weekDate", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+		return
+	}
+
+	var req CopyWeekRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	source := Task{DayOfWeek: daysOfWeek[time.Sunday], WeekDate: weekDate}
+	var date time.Time
+	fieldErrors := []FieldError{{Field: "weekDate", Code: fieldRequired, Message: "weekDate or relative is required"}}
+	if req.WeekDate != "" || req.Relative != "" {
+		date, fieldErrors = resolveTarget(&source, taskTarget{WeekDate: req.WeekDate, Relative: req.Relative})
+	}
+	if len(fieldErrors) > 0 {
+		logger.Warn("Invalid copy target", "week", weekDate, "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+	from, _ := taskDate(&source) // the normalized week start is always a date
+	days := daysBetween(from, getWeekStart(date))
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	tasks, err := queryTasks(r.Context(), tx, "week_date = ?", weekDate)
+	if err != nil {
+		logger.Error("Database query failed", "week", weekDate, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if fieldErrors := undatedTasks("weekDate", tasks); len(fieldErrors) > 0 {
+		logger.Warn("Week has undated tasks", "week", weekDate, "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+	copies, err := copyTasks(r.Context(), tx, tasks, days)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Database insert failed", "week", weekDate, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Week copied", "week", weekDate, "to", getWeekStart(date).Format("2006-01-02"), "copies", len(copies))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(copies)
+}
+
+// ReorderTaskRequest is the body of POST /api/tasks/{id}/reorder. After is
+// the task that should come right before this one and Before the task that
+// should come right after it; give either or both. A task dropped next to
+// tasks of another day moves to that day.
+type ReorderTaskRequest struct {
+	Before int `json:"before,omitempty"`
+	After  int `json:"after,omitempty"`
+}
+
+// loadNeighbour loads the task named by a reorder field. It returns nil when
+// the field is not set.
+func loadNeighbour(ctx context.Context, q queryer, field string, id, self int) (*Task, *FieldError, error) {
+	if id == 0 {
+		return nil, nil, nil
+	}
+	if id == self {
+		return nil, &FieldError{Field: field, Code: fieldInvalid, Message: "must be another task"}, nil
+	}
+	task, err := loadTask(ctx, q, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &FieldError{Field: field, Code: fieldInvalid, Message: "is not an existing task"}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &task, nil, nil
+}
+
+// reorderTaskTo gives a task a position between its new neighbours. Only
+// the task's row is written, unless the day has to be rebalanced first.
+func reorderTaskTo(ctx context.Context, q queryer, id int, req ReorderTaskRequest) (Task, []FieldError, error) {
+	current, err := loadTask(ctx, q, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	if req.Before == 0 && req.After == 0 {
+		return Task{}, []FieldError{{Field: "after", Code: fieldRequired, Message: "after or before is required"}}, nil
+	}
+
+	var fieldErrors []FieldError
+	after, afterErr, err := loadNeighbour(ctx, q, "after", req.After, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	before, beforeErr, err := loadNeighbour(ctx, q, "before", req.Before, id)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	for _, fieldError := range []*FieldError{afterErr, beforeErr} {
+		if fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return Task{}, fieldErrors, nil
+	}
+
+	dest := after
+	if dest == nil {
+		dest = before
+	}
+	if after != nil && before != nil && (after.WeekDate != before.WeekDate || after.DayOfWeek != before.DayOfWeek) {
+		return Task{}, []FieldError{{Field: "before", Code: fieldInvalid, Message: "must be in the same day as after"}}, nil
+	}
+
+	var position string
+	for rebalanced := false; ; rebalanced = true {
+		var lower, upper sql.NullString
+		switch {
+		case after != nil && before != nil:
+			err = q.QueryRowContext(ctx, "SELECT (SELECT position FROM tasks WHERE id = ?), (SELECT position FROM tasks WHERE id = ?)", after.ID, before.ID).Scan(&lower, &upper)
+		case after != nil:
+			err = q.QueryRowContext(ctx, `SELECT a.position, (SELECT MIN(position) FROM tasks
+				WHERE week_date = a.week_date AND day_of_week = a.day_of_week AND position > a.position AND id != ?)
+				FROM tasks a WHERE a.id = ?`, id, after.ID).Scan(&lower, &upper)
+		default:
+			err = q.QueryRowContext(ctx, `SELECT (SELECT MAX(position) FROM tasks
+				WHERE week_date = b.week_date AND day_of_week = b.day_of_week AND position < b.position AND id != ?), b.position
+				FROM tasks b WHERE b.id = ?`, id, before.ID).Scan(&lower, &upper)
+		}
+		if err != nil {
+			return Task{}, nil, err
+		}
+
+		// Equal or empty neighbour keys, left by concurrent inserts or old
+		// rows, are fixed by rebalancing as well.
+		ordered := (after == nil || lower.String != "") && (before == nil || upper.String != "") &&
+			(upper.String == "" || lower.String < upper.String)
+		if ordered {
+			position = rankBetween(lower.String, upper.String)
+			if len(position) <= maxRankLength || rebalanced {
+				break
+			}
+		} else if rebalanced {
+			return Task{}, []FieldError{{Field: "before", Code: fieldInvalid, Message: "must come after the task given in after"}}, nil
+		}
+		if err := rebalanceDay(ctx, q, dest.WeekDate, dest.DayOfWeek); err != nil {
+			return Task{}, nil, err
+		}
+	}
+
+	result, err := q.ExecContext(ctx, "UPDATE tasks SET week_date = ?, day_of_week = ?, position = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		dest.WeekDate, dest.DayOfWeek, position, id)
+	if err := checkAffected(result, err); err != nil {
+		return Task{}, nil, err
+	}
+	task, err := reloadTask(ctx, q, &current)
+	return task, nil, err
+}
+
+func reorderTask(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
+		return
+	}
+
+	var req ReorderTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	task, fieldErrors, err := reorderTaskTo(r.Context(), tx, id, req)
+	if err == nil && len(fieldErrors) == 0 {
+		err = tx.Commit()
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not found", "task_id", id)
+		writeTaskNotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Database update failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		logger.Warn("Invalid reorder request", "task_id", id, "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	logger.Info("Task reordered", "task_id", id, "position", task.Position)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestParseRelativeDays(t *testing.T) {
+	for in, want := range map[string]int{
+		"+1 day":       1,
+		"1 day":        1,
+		"-2 weeks":     -14,
+		"3d":           3,
+		"+1w":          7,
+		"  Next  Week": 7,
+		"tomorrow":     1,
+		"yesterday":    -1,
+		"last week":    -7,
+		"0 days":       0,
+	} {
+		if got, ok := parseRelativeDays(in); !ok || got != want {
+			t.Errorf("parseRelativeDays(%q) = %d, %t; want %d", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "soon", "1 month", "+ 1 day", "1.5 days", "99999 days", "-600 weeks"} {
+		if got, ok := parseRelativeDays(in); ok {
+			t.Errorf("parseRelativeDays(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestMoveAndCopyRelative(t *testing.T) {
+	c := newTestClient(t)
+	// Saturday 2024-01-13 is the last day of the week of 2024-01-07.
+	c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"saturday","weekDate":"2024-01-07"}`)
+	c.call("POST", "/api/tasks", `{"title":"Review","dayOfWeek":"monday","weekDate":"2024-01-14"}`)
+	c.call("POST", "/api/tasks", `{"title":"Ship","dayOfWeek":"wednesday","weekDate":"2024-01-07"}`)
+
+	// moveTo moves task 1 and returns where it ended up.
+	moveTo := func(body string) (int, Task) {
+		status, data := c.call("POST", "/api/tasks/1/move", body)
+		var task Task
+		if status == http.StatusOK {
+			c.decode(data, &task)
+		}
+		return status, task
+	}
+	for _, tc := range []struct {
+		body      string
+		day, week string
+	}{
+		{`{"relative":"+1 day"}`, "sunday", "2024-01-14"},      // into the next week
+		{`{"relative":"-1 day"}`, "saturday", "2024-01-07"},    // and back
+		{`{"relative":"next week"}`, "saturday", "2024-01-14"}, // same weekday
+		{`{"relative":"-2 weeks"}`, "saturday", "2023-12-31"},
+		{`{"relative":"3d"}`, "tuesday", "2024-01-07"},
+		{`{"dayOfWeek":"mon"}`, "monday", "2024-01-07"},
+		{`{"weekDate":"2024-01-17"}`, "monday", "2024-01-14"},
+	} {
+		status, task := moveTo(tc.body)
+		if status != http.StatusOK || task.DayOfWeek != tc.day || task.WeekDate != tc.week {
+			t.Errorf("move %s: status %d, now %s of %s; want %s of %s", tc.body, status, task.DayOfWeek, task.WeekDate, tc.day, tc.week)
+		}
+	}
+	// The moved task went after Review, which was already on that Monday.
+	if moved, review := c.task(1), c.task(2); moved.Position <= review.Position {
+		t.Errorf("moved task position %q is not after %q", moved.Position, review.Position)
+	}
+	for _, body := range []string{`{"relative":"someday"}`, `{"relative":"+1 day","dayOfWeek":"mon"}`, `{}`} {
+		if status, _ := moveTo(body); status != http.StatusUnprocessableEntity {
+			t.Errorf("move %s: status %d, want 422", body, status)
+		}
+	}
+
+	// A copy leaves the original where it was and starts with an unchecked
+	// checklist.
+	c.call("PUT", "/api/tasks/3", `{"title":"Ship","description":"- [x] build\n- [ ] deploy","dayOfWeek":"wednesday","weekDate":"2024-01-07"}`)
+	status, data := c.call("POST", "/api/tasks/3/copy", `{"relative":"tomorrow"}`)
+	var copies []Task
+	c.decode(data, &copies)
+	if status != http.StatusCreated || len(copies) != 1 || copies[0].DayOfWeek != "thursday" || copies[0].WeekDate != "2024-01-07" || copies[0].ID == 3 {
+		t.Fatalf("copy tomorrow: status %d, body %s", status, data)
+	}
+	if got := copies[0].Description; got != "- [ ] build\n- [ ] deploy" {
+		t.Errorf("copied description = %q", got)
+	}
+	if original := c.task(3); original.DayOfWeek != "wednesday" || original.Checklist.Done != 1 {
+		t.Errorf("original after copy = %+v", original)
+	}
+
+	// A week copy shifts every task by the same amount, keeping weekdays.
+	status, data = c.call("POST", "/api/tasks/week/2024-01-14/copy", `{"relative":"next week"}`)
+	copies = nil
+	c.decode(data, &copies)
+	if status != http.StatusCreated || len(copies) != 2 {
+		t.Fatalf("copy week: status %d, body %s", status, data)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-21"); got != "Review,Plan" {
+		t.Errorf("copied week = %s, want Review,Plan", got)
+	}
+	for _, task := range copies {
+		if task.WeekDate != "2024-01-21" || task.DayOfWeek != "monday" || task.Completed {
+			t.Errorf("week copy = %+v", task)
+		}
+	}
+
+	status, data = c.call("POST", "/api/tasks/2/copy", `{"relative":"-1 week","scope":"week"}`)
+	copies = nil
+	c.decode(data, &copies)
+	if status != http.StatusCreated || len(copies) != 2 {
+		t.Errorf("copy scope week: status %d, body %s", status, data)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "Review,Plan,Ship,Ship" {
+		t.Errorf("week after scope copy = %s", got)
+	}
+}
+
+func TestCopyUndatedTasks(t *testing.T) {
+	c := newTestClient(t)
+	c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	c.call("POST", "/api/tasks", `{"title":"Review","dayOfWeek":"tuesday","weekDate":"2024-01-07"}`)
+	// A row from before validation, whose day does not form a date.
+	if _, err := db.Exec("UPDATE tasks SET day_of_week = 'someday' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path, body, field string
+	}{
+		{"/api/tasks/2/copy", `{"weekDate":"2024-01-14","dayOfWeek":"monday"}`, "scope"},
+		{"/api/tasks/2/copy", `{"relative":"next week"}`, "relative"},
+		{"/api/tasks/1/copy", `{"relative":"next week","scope":"week"}`, "scope"},
+		{"/api/tasks/week/2024-01-07/copy", `{"relative":"next week"}`, "weekDate"},
+	} {
+		status, data := c.call("POST", tc.path, tc.body)
+		var problem Problem
+		c.decode(data, &problem)
+		if status != http.StatusUnprocessableEntity || len(problem.Errors) != 1 || problem.Errors[0].Field != tc.field {
+			t.Errorf("POST %s %s: status %d, body %s", tc.path, tc.body, status, data)
+		}
+	}
+	if got := c.titles("/api/tasks/week/2024-01-14"); got != "" {
+		t.Errorf("failed copies left %s behind", got)
+	}
+}
+
+func TestReorderTask(t *testing.T) {
+	c := newTestClient(t)
+	for _, title := range []string{"A", "B", "C", "D"} {
+		c.call("POST", "/api/tasks", `{"title":"`+title+`","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	}
+	c.call("POST", "/api/tasks", `{"title":"E","dayOfWeek":"tuesday","weekDate":"2024-01-07"}`)
+	// E is on Tuesday, which the week list shows after Monday.
+	week := func() string { return c.titles("/api/tasks/week/2024-01-07") }
+
+	for _, tc := range []struct {
+		id   int
+		body string
+		want string
+	}{
+		{4, `{"before":1}`, "D,A,B,C,E"},           // top
+		{1, `{"after":3}`, "D,B,C,A,E"},            // bottom
+		{3, `{"after":4,"before":2}`, "D,C,B,A,E"}, // between
+		{2, `{"after":1}`, "D,C,A,B,E"},            // after a task with no successor
+		{5, `{"after":4,"before":3}`, "D,E,C,A,B"},
+	} {
+		status, data := c.call("POST", fmt.Sprintf("/api/tasks/%d/reorder", tc.id), tc.body)
+		if status != http.StatusOK {
+			t.Fatalf("reorder %d %s: status %d, body %s", tc.id, tc.body, status, data)
+		}
+		if got := week(); got != tc.want {
+			t.Errorf("after reorder %d %s: week = %s, want %s", tc.id, tc.body, got, tc.want)
+		}
+	}
+	// Dropping E between Monday tasks moved it to Monday.
+	if task := c.task(5); task.DayOfWeek != "monday" {
+		t.Errorf("reordered task is on %s, want monday", task.DayOfWeek)
+	}
+
+	// Dropping tasks again and again into the same gap lengthens the keys
+	// until the day is rebalanced, which keeps them short and in order.
+	first := c.task(4).Position
+	for i := 0; c.task(4).Position == first; i++ {
+		if i == 500 {
+			t.Fatal("the day was never rebalanced")
+		}
+		id, other := 1, 2
+		if i%2 == 1 {
+			id, other = 2, 1
+		}
+		c.call("POST", fmt.Sprintf("/api/tasks/%d/reorder", id), fmt.Sprintf(`{"after":4,"before":%d}`, other))
+		if task := c.task(id); len(task.Position) > maxRankLength {
+			t.Fatalf("reorder %d: position %q is longer than %d", i, task.Position, maxRankLength)
+		}
+	}
+	if got := week(); got != "D,A,B,E,C" && got != "D,B,A,E,C" {
+		t.Errorf("after repeated reorders: week = %s", got)
+	}
+
+	// Equal keys, as left by concurrent inserts, are rebalanced too. Ties
+	// are listed by ID, so B comes before D.
+	if _, err := db.Exec("UPDATE tasks SET position = (SELECT position FROM tasks WHERE id = 4) WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if status, data := c.call("POST", "/api/tasks/1/reorder", `{"after":2,"before":4}`); status != http.StatusOK {
+		t.Fatalf("reorder between equal keys: status %d, body %s", status, data)
+	}
+	if got := week(); got != "B,A,D,E,C" {
+		t.Errorf("after reorder between equal keys: week = %s, want B,A,D,E,C", got)
+	}
+	if b, d := c.task(2), c.task(4); b.Position >= d.Position {
+		t.Errorf("positions %q and %q are still not ordered", b.Position, d.Position)
+	}
+
+	for _, body := range []string{`{}`, `{"after":1}`, `{"after":99}`, `{"after":4,"before":2}`} {
+		if status, data := c.call("POST", "/api/tasks/1/reorder", body); status != http.StatusUnprocessableEntity {
+			t.Errorf("reorder %s: status %d, body %s", body, status, data)
+		}
+	}
+}
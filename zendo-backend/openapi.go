@@ -0,0 +1,95 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/swaggest/swgui/v5emb"
+)
+
+// openAPISpec documents every route registered by newRouter. openapi_test.go
+// fails when a route is added without documenting it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// apiDocs serves Swagger UI for the OpenAPI document. Its assets are
+// embedded in the binary, so the page works without internet access.
+var apiDocs = v5emb.New("Zendo API", "/api/openapi.json", "/api/docs/")
+
+// router is a ServeMux that remembers the patterns registered on it.
+type router struct {
+	*http.ServeMux
+	patterns  []string
+	taskLists map[string]http.HandlerFunc
+}
+
+func (r *router) Handle(pattern string, handler http.Handler) {
+	r.patterns = append(r.patterns, pattern)
+	r.ServeMux.Handle(pattern, handler)
+}
+
+func (r *router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	r.patterns = append(r.patterns, pattern)
+	r.ServeMux.HandleFunc(pattern, handler)
+}
+
+// HandleTaskList registers GET /api/tasks/{id}/<name>. A pattern per list
+// would conflict with GET /api/tasks/week/{weekDate}, as both match
+// /api/tasks/week/<name>, so the lists share one pattern and are dispatched
+// by name. The week route is more specific and keeps its paths.
+func (r *router) HandleTaskList(name string, handler http.HandlerFunc) {
+	if r.taskLists == nil {
+		r.taskLists = make(map[string]http.HandlerFunc)
+		r.ServeMux.HandleFunc("GET /api/tasks/{id}/{list}", r.serveTaskList)
+	}
+	r.patterns = append(r.patterns, "GET /api/tasks/{id}/"+name)
+	r.taskLists[name] = handler
+}
+
+func (r *router) serveTaskList(w http.ResponseWriter, req *http.Request) {
+	handler, ok := r.taskLists[req.PathValue("list")]
+	if !ok {
+		writeProblem(w, req, http.StatusNotFound, codeNotFound, "No API endpoint at this path")
+		return
+	}
+	handler(w, req)
+}
+
+// apiMethods are the methods the API routes are registered with.
+var apiMethods = []string{"GET", "POST", "PUT", "DELETE"}
+
+// serveUnknownAPI answers API requests no route matched, which would
+// otherwise fall through to the frontend: 405 with an Allow header when the
+// path exists for other methods, else 404.
+func (r *router) serveUnknownAPI(w http.ResponseWriter, req *http.Request) {
+	var allowed []string
+	for _, method := range apiMethods {
+		probe := req.Clone(req.Context())
+		probe.Method = method
+		_, pattern := r.Handler(probe)
+		if pattern == "/api/" || pattern == "" {
+			continue
+		}
+		if strings.HasSuffix(pattern, "/{list}") && r.taskLists[path.Base(req.URL.Path)] == nil {
+			continue
+		}
+		allowed = append(allowed, method)
+	}
+
+	if len(allowed) == 0 {
+		writeProblem(w, req, http.StatusNotFound, codeNotFound, "No API endpoint at this path")
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeProblem(w, req, http.StatusMethodNotAllowed, codeMethodNotAllowed,
+		fmt.Sprintf("%s is not supported here, use %s", req.Method, strings.Join(allowed, " or ")))
+}
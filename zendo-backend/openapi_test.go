@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openAPIDocument is the subset of an OpenAPI document the tests inspect.
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]*schema `json:"schemas"`
+		Responses map[string]struct {
+			Content map[string]struct {
+				Schema *schema `json:"schema"`
+			} `json:"content"`
+		} `json:"responses"`
+	} `json:"components"`
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+}
+
+type operation struct {
+	Responses map[string]struct {
+		Ref     string `json:"$ref"`
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+func loadOpenAPI(t *testing.T) *openAPIDocument {
+	t.Helper()
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("parsing openapi.json: %v", err)
+	}
+	return &doc
+}
+
+// resolve follows a local component reference.
+func (d *openAPIDocument) resolve(t *testing.T, s *schema) *schema {
+	t.Helper()
+	if s == nil || s.Ref == "" {
+		return s
+	}
+	name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+	if !ok || d.Components.Schemas[name] == nil {
+		t.Fatalf("unresolvable schema reference %q", s.Ref)
+	}
+	return d.Components.Schemas[name]
+}
+
+var httpMethods = map[string]bool{"get": true, "put": true, "post": true, "delete": true, "patch": true, "head": true, "options": true}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	doc := loadOpenAPI(t)
+	mux, err := newRouter()
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+
+	registered := make(map[string]bool)
+	for _, pattern := range mux.patterns {
+		if pattern == "/" {
+			continue // the frontend SPA
+		}
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			t.Errorf("pattern %q has no method", pattern)
+			continue
+		}
+		registered[pattern] = true
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %q is not documented in openapi.json", pattern)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if !httpMethods[method] {
+				continue
+			}
+			pattern := strings.ToUpper(method) + " " + path
+			if !registered[pattern] {
+				t.Errorf("openapi.json documents %q, which is not registered", pattern)
+			}
+		}
+	}
+}
+
+// schemaStructs maps component schemas to the Go types they describe.
+// Response types must mark exactly their non-omitempty fields as required.
+var schemaStructs = []struct {
+	name     string
+	typ      reflect.Type
+	response bool
+}{
+	{"Task", reflect.TypeOf(Task{}), true},
+	{"CreateTaskRequest", reflect.TypeOf(CreateTaskRequest{}), false},
+	{"UpdateTaskRequest", reflect.TypeOf(UpdateTaskRequest{}), false},
+	{"BackupSnapshot", reflect.TypeOf(BackupSnapshot{}), true},
+	{"Problem", reflect.TypeOf(Problem{}), true},
+	{"FieldError", reflect.TypeOf(FieldError{}), true},
+	{"BulkRequest", reflect.TypeOf(BulkRequest{}), false},
+	{"BulkOperation", reflect.TypeOf(BulkOperation{}), false},
+	{"BulkResult", reflect.TypeOf(BulkResult{}), true},
+	{"BulkError", reflect.TypeOf(BulkError{}), true},
+	{"BulkResponse", reflect.TypeOf(BulkResponse{}), true},
+	{"MoveTaskRequest", reflect.TypeOf(MoveTaskRequest{}), false},
+	{"CopyTaskRequest", reflect.TypeOf(CopyTaskRequest{}), false},
+	{"CopyWeekRequest", reflect.TypeOf(CopyWeekRequest{}), false},
+	{"ReorderTaskRequest", reflect.TypeOf(ReorderTaskRequest{}), false},
+	{"TaskMatrix", reflect.TypeOf(TaskMatrix{}), true},
+	{"Checklist", reflect.TypeOf(Checklist{}), true},
+	{"Attachment", reflect.TypeOf(Attachment{}), true},
+	{"Comment", reflect.TypeOf(Comment{}), true},
+	{"CommentRequest", reflect.TypeOf(CommentRequest{}), false},
+	{"TaskEvent", reflect.TypeOf(TaskEvent{}), true},
+	{"ActivityItem", reflect.TypeOf(ActivityItem{}), true},
+	{"AuditRecord", reflect.TypeOf(AuditRecord{}), true},
+	{"FieldChange", reflect.TypeOf(FieldChange{}), true},
+	{"RevertTaskRequest", reflect.TypeOf(RevertTaskRequest{}), false},
+	{"UndoResponse", reflect.TypeOf(UndoResponse{}), true},
+	{"Project", reflect.TypeOf(Project{}), true},
+	{"ProjectProgress", reflect.TypeOf(ProjectProgress{}), true},
+	{"ProjectRequest", reflect.TypeOf(ProjectRequest{}), false},
+	{"Template", reflect.TypeOf(Template{}), true},
+	{"TemplateTask", reflect.TypeOf(TemplateTask{}), true},
+	{"TemplateRequest", reflect.TypeOf(TemplateRequest{}), false},
+	{"SaveTemplateRequest", reflect.TypeOf(SaveTemplateRequest{}), false},
+}
+
+// jsonSchemaType returns the JSON Schema type and format encoding/json
+// produces for t.
+func jsonSchemaType(t reflect.Type) (string, string) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string", "date-time"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", ""
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer", ""
+	case reflect.Float32, reflect.Float64:
+		return "number", ""
+	case reflect.String:
+		return "string", ""
+	case reflect.Slice, reflect.Array:
+		return "array", ""
+	case reflect.Map, reflect.Struct:
+		return "object", ""
+	}
+	return "", ""
+}
+
+func TestOpenAPISchemasMatchStructs(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	for _, tc := range schemaStructs {
+		s := doc.Components.Schemas[tc.name]
+		if s == nil {
+			t.Errorf("schema %s is missing", tc.name)
+			continue
+		}
+
+		var fields, required []string
+		for i := 0; i < tc.typ.NumField(); i++ {
+			field := tc.typ.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fields = append(fields, name)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+
+			prop := doc.resolve(t, s.Properties[name])
+			if prop == nil {
+				t.Errorf("%s: field %s is not documented", tc.name, name)
+				continue
+			}
+			typ, format := jsonSchemaType(field.Type)
+			if prop.Type != typ {
+				t.Errorf("%s.%s: documented as %q, encoded as %q", tc.name, name, prop.Type, typ)
+			}
+			if format == "date-time" && prop.Format != format {
+				t.Errorf("%s.%s: documented format %q, want %q", tc.name, name, prop.Format, format)
+			}
+		}
+
+		for name := range s.Properties {
+			if !contains(fields, name) {
+				t.Errorf("%s: documented property %s does not exist on %s", tc.name, name, tc.typ)
+			}
+		}
+		if tc.response {
+			sort.Strings(required)
+			documented := append([]string(nil), s.Required...)
+			sort.Strings(documented)
+			if !reflect.DeepEqual(documented, required) {
+				t.Errorf("%s: required is %v, want the non-omitempty fields %v", tc.name, documented, required)
+			}
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// responseSchema returns the JSON schema of a documented response.
+func (d *openAPIDocument) responseSchema(t *testing.T, path, method, status string) *schema {
+	t.Helper()
+	var op operation
+	if err := json.Unmarshal(d.Paths[path][method], &op); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	response, ok := op.Responses[status]
+	if !ok {
+		t.Fatalf("%s %s: status %s is not documented", method, path, status)
+	}
+	content := response.Content
+	if name, ok := strings.CutPrefix(response.Ref, "#/components/responses/"); ok {
+		content = d.Components.Responses[name].Content
+	}
+	for mediaType, media := range content {
+		if strings.HasSuffix(mediaType, "json") {
+			return d.resolve(t, media.Schema)
+		}
+	}
+	t.Fatalf("%s %s: status %s has no JSON schema", method, path, status)
+	return nil
+}
+
+// checkShape verifies that value has exactly the properties of s.
+func checkShape(t *testing.T, label string, s *schema, value interface{}) {
+	t.Helper()
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		t.Errorf("%s: expected an object, got %T", label, value)
+		return
+	}
+	for name := range object {
+		if s.Properties[name] == nil {
+			t.Errorf("%s: undocumented property %s", label, name)
+		}
+	}
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			t.Errorf("%s: missing required property %s", label, name)
+		}
+	}
+}
+
+func TestOpenAPITaskResponsesMatchServer(t *testing.T) {
+	doc := loadOpenAPI(t)
+	server := newTestServer(t)
+
+	call := func(method, path, body string) (int, interface{}) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var decoded interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+		return resp.StatusCode, decoded
+	}
+
+	week := getWeekStart(time.Now().In(timezone)).Format("2006-01-02")
+	status, created := call("POST", "/api/tasks", fmt.Sprintf(`{"title":"Write docs","dayOfWeek":"monday","weekDate":%q,"tags":"docs"}`, week))
+	checkShape(t, "POST /api/tasks", doc.responseSchema(t, "/api/tasks", "post", fmt.Sprint(status)), created)
+	id := int(created.(map[string]interface{})["id"].(float64))
+
+	status, updated := call("PUT", fmt.Sprintf("/api/tasks/%d", id), fmt.Sprintf(`{"title":"Write docs","completed":true,"dayOfWeek":"monday","weekDate":%q}`, week))
+	checkShape(t, "PUT /api/tasks/{id}", doc.responseSchema(t, "/api/tasks/{id}", "put", fmt.Sprint(status)), updated)
+
+	for _, path := range []string{"/api/tasks", "/api/tasks/week/{weekDate}", "/api/tasks/today/week"} {
+		s := doc.responseSchema(t, path, "get", "200")
+		if s.Type != "array" {
+			t.Fatalf("GET %s: documented as %q, want an array of tasks", path, s.Type)
+		}
+		status, list := call("GET", strings.Replace(path, "{weekDate}", week, 1), "")
+		tasks, ok := list.([]interface{})
+		if status != http.StatusOK || !ok || len(tasks) == 0 {
+			t.Fatalf("GET %s: status %d, body %v", path, status, list)
+		}
+		for _, task := range tasks {
+			checkShape(t, "GET "+path, doc.resolve(t, s.Items), task)
+		}
+	}
+
+	status, problem := call("PUT", "/api/tasks/999999", `{"title":"x","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	checkShape(t, "PUT /api/tasks/{id} (missing)", doc.responseSchema(t, "/api/tasks/{id}", "put", fmt.Sprint(status)), problem)
+
+	status, problem = call("POST", "/api/tasks", `{"title":""}`)
+	checkShape(t, "POST /api/tasks (invalid)", doc.responseSchema(t, "/api/tasks", "post", fmt.Sprint(status)), problem)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskMatrix groups open tasks into the Eisenhower quadrants: do (urgent and
+// important), schedule (important), delegate (urgent) and eliminate
+// (neither).
+type TaskMatrix struct {
+	WeekDate  string `json:"weekDate"`
+	Do        []Task `json:"do"`
+	Schedule  []Task `json:"schedule"`
+	Delegate  []Task `json:"delegate"`
+	Eliminate []Task `json:"eliminate"`
+}
+
+// likeEscaper escapes the LIKE wildcards in search words.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// priorityOrder sorts tasks by quadrant, most pressing first.
+const priorityOrder = "important DESC, urgent DESC, "
+
+// listFilters holds the filter and sort query parameters shared by the task
+// list endpoints.
+type listFilters struct {
+	where      string // conditions, each starting with " AND"
+	args       []interface{}
+	byPriority bool
+}
+
+// parseListFilters reads the q, urgent, important, project and sort query
+// parameters.
+func parseListFilters(r *http.Request) (listFilters, []FieldError) {
+	var filters listFilters
+	var fieldErrors []FieldError
+	query := r.URL.Query()
+
+	// Every word of q must appear in the title, description or tags.
+	for _, word := range strings.Fields(query.Get("q")) {
+		pattern := "%" + likeEscaper.Replace(word) + "%"
+		filters.where += ` AND (title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR tags LIKE ? ESCAPE '\')`
+		filters.args = append(filters.args, pattern, pattern, pattern)
+	}
+
+	for _, flag := range []string{"urgent", "important"} {
+		s := query.Get(flag)
+		if s == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(s)
+		if err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: flag, Code: fieldInvalid, Message: "must be true or false"})
+			continue
+		}
+		filters.where += " AND " + flag + " = ?"
+		filters.args = append(filters.args, value)
+	}
+
+	where, args, projectErrors := parseProjectFilter(query)
+	filters.where += where
+	filters.args = append(filters.args, args...)
+	fieldErrors = append(fieldErrors, projectErrors...)
+
+	switch query.Get("sort") {
+	case "", "position":
+	case "priority":
+		filters.byPriority = true
+	default:
+		fieldErrors = append(fieldErrors, FieldError{Field: "sort", Code: fieldInvalid, Message: "must be position or priority"})
+	}
+	return filters, fieldErrors
+}
+
+// orderBy prefixes order with the priority order when it was requested.
+func (f listFilters) orderBy(order string) string {
+	if f.byPriority {
+		return priorityOrder + order
+	}
+	return order
+}
+
+// writeInvalidFilters rejects bad list query parameters.
+func writeInvalidFilters(w http.ResponseWriter, r *http.Request, fieldErrors []FieldError) {
+	requestLogger(r).Warn("Invalid list parameters", "errors", fieldErrors)
+	writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter", fieldErrors...)
+}
+
+// getTaskMatrix returns the open tasks of a week, by default the current
+// one, grouped into the Eisenhower quadrants.
+func getTaskMatrix(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	weekDate := getWeekStart(time.Now().In(timezone)).Format("2006-01-02")
+	if s := r.URL.Query().Get("week"); s != "" {
+		week, ok := normalizeWeekDate(s)
+		if !ok {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter",
+				FieldError{Field: "week", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+			return
+		}
+		weekDate = week
+	}
+	where, args, fieldErrors := parseProjectFilter(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
+	}
+
+	tasks, err := queryTasks(r.Context(), db, "week_date = ? AND NOT completed"+where, append([]interface{}{weekDate}, args...)...)
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	// Positions only order tasks within a day, so sort by date first.
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, _ := taskDate(&tasks[i])
+		b, _ := taskDate(&tasks[j])
+		return a.Before(b)
+	})
+
+	if err := renderDescriptions(r, tasks); err != nil {
+		logger.Error("Rendering descriptions failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	matrix := TaskMatrix{WeekDate: weekDate, Do: []Task{}, Schedule: []Task{}, Delegate: []Task{}, Eliminate: []Task{}}
+	for _, task := range tasks {
+		switch {
+		case task.Urgent && task.Important:
+			matrix.Do = append(matrix.Do, task)
+		case task.Important:
+			matrix.Schedule = append(matrix.Schedule, task)
+		case task.Urgent:
+			matrix.Delegate = append(matrix.Delegate, task)
+		default:
+			matrix.Eliminate = append(matrix.Eliminate, task)
+		}
+	}
+
+	logger.Debug("Returned task matrix", "week", weekDate, "count", len(tasks))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matrix)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPriorityFilters(t *testing.T) {
+	c := newTestClient(t)
+	for _, task := range []struct {
+		title             string
+		urgent, important bool
+		day               string
+	}{
+		{"Neither", false, false, "monday"},
+		{"Urgent", true, false, "monday"},
+		{"Important", false, true, "tuesday"},
+		{"Both", true, true, "wednesday"},
+		{"Both later", true, true, "friday"},
+	} {
+		c.call("POST", "/api/tasks", fmt.Sprintf(`{"title":%q,"dayOfWeek":%q,"weekDate":"2024-01-07","urgent":%t,"important":%t}`,
+			task.title, task.day, task.urgent, task.important))
+	}
+
+	// Week lists are ordered by day_of_week, so Friday comes first.
+	for query, want := range map[string]string{
+		"":                              "Both later,Neither,Urgent,Important,Both",
+		"?urgent=true":                  "Both later,Urgent,Both",
+		"?urgent=false":                 "Neither,Important",
+		"?important=1&urgent=0":         "Important",
+		"?sort=priority":                "Both later,Both,Important,Urgent,Neither",
+		"?sort=priority&important=true": "Both later,Both,Important",
+		"?sort=position":                "Both later,Neither,Urgent,Important,Both",
+	} {
+		if got := c.titles("/api/tasks/week/2024-01-07" + query); got != want {
+			t.Errorf("week%s = %s, want %s", query, got, want)
+		}
+	}
+
+	for _, query := range []string{"?urgent=maybe", "?important=", "?sort=title"} {
+		status, data := c.call("GET", "/api/tasks/week/2024-01-07"+query, "")
+		if query == "?important=" {
+			// An empty value is the same as no filter.
+			if status != http.StatusOK {
+				t.Errorf("week%s: status %d", query, status)
+			}
+			continue
+		}
+		if status != http.StatusBadRequest || !strings.Contains(string(data), codeInvalidParameter) {
+			t.Errorf("week%s: status %d, body %s", query, status, data)
+		}
+	}
+}
+
+func TestTaskMatrix(t *testing.T) {
+	c := newTestClient(t)
+	for _, task := range []struct {
+		title             string
+		urgent, important bool
+		day               string
+	}{
+		{"Friday fire", true, true, "friday"},
+		{"Monday fire", true, true, "monday"},
+		{"Plan", false, true, "tuesday"},
+		{"Calls", true, false, "monday"},
+		{"Browse", false, false, "sunday"},
+		{"Done fire", true, true, "monday"},
+	} {
+		c.call("POST", "/api/tasks", fmt.Sprintf(`{"title":%q,"dayOfWeek":%q,"weekDate":"2024-01-07","urgent":%t,"important":%t}`,
+			task.title, task.day, task.urgent, task.important))
+	}
+	c.call("POST", "/api/tasks", `{"title":"Next week","dayOfWeek":"monday","weekDate":"2024-01-14","urgent":true,"important":true}`)
+	c.call("POST", "/api/tasks/bulk", `{"operations":[{"op":"complete","id":6}]}`)
+
+	status, data := c.call("GET", "/api/tasks/matrix?week=2024-01-10", "")
+	var matrix TaskMatrix
+	c.decode(data, &matrix)
+	if status != http.StatusOK || matrix.WeekDate != "2024-01-07" {
+		t.Fatalf("matrix: status %d, body %s", status, data)
+	}
+	names := func(tasks []Task) string {
+		var titles []string
+		for _, task := range tasks {
+			titles = append(titles, task.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+	// Open tasks of the week only, in date order within a quadrant.
+	for quadrant, got := range map[string][]Task{
+		"Monday fire,Friday fire": matrix.Do,
+		"Plan":                    matrix.Schedule,
+		"Calls":                   matrix.Delegate,
+		"Browse":                  matrix.Eliminate,
+	} {
+		if names(got) != quadrant {
+			t.Errorf("quadrant = %s, want %s", names(got), quadrant)
+		}
+	}
+
+	// Empty quadrants are empty arrays, not null.
+	_, data = c.call("GET", "/api/tasks/matrix?week=2030-01-06", "")
+	if !strings.Contains(string(data), `"do":[]`) || !strings.Contains(string(data), `"eliminate":[]`) {
+		t.Errorf("empty matrix = %s", data)
+	}
+	if status, _ := c.call("GET", "/api/tasks/matrix?week=soon", ""); status != http.StatusBadRequest {
+		t.Errorf("matrix with a bad week: status %d, want 400", status)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// API errors are returned as RFC 9457 problem details. Every problem carries
+// a stable code that clients can match on; the detail text is for humans and
+// may change. Internal errors are logged but never described to the client.
+
+// Error codes returned in the "code" member of a problem.
+const (
+	codeInvalidJSON          = "invalid_json"
+	codeInvalidID            = "invalid_id"
+	codeInvalidParameter     = "invalid_parameter"
+	codeValidationFailed     = "validation_failed"
+	codeTaskNotFound         = "task_not_found"
+	codeAttachmentNotFound   = "attachment_not_found"
+	codeCommentNotFound      = "comment_not_found"
+	codeTemplateNotFound     = "template_not_found"
+	codeProjectNotFound      = "project_not_found"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeBulkFailed           = "bulk_failed"
+	codeNothingToUndo        = "nothing_to_undo"
+	codeNothingToRedo        = "nothing_to_redo"
+	codeUndoConflict         = "undo_conflict"
+	codePayloadTooLarge      = "payload_too_large"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeQuotaExceeded        = "quota_exceeded"
+	codeRateLimited          = "rate_limited"
+	codeUnauthorized         = "unauthorized"
+	codeAdminDisabled        = "admin_disabled"
+	codeInvalidSnapshot      = "invalid_snapshot"
+	codeInternalError        = "internal_error"
+)
+
+// Field error codes returned in the "errors" member of a problem.
+const (
+	fieldRequired = "required"
+	fieldTooLong  = "too_long"
+	fieldTooMany  = "too_many"
+	fieldInvalid  = "invalid"
+)
+
+// problemTypePrefix forms the problem type URI from its code.
+const problemTypePrefix = "urn:zendo:problem:"
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid request field or query parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeProblem sends a problem response with the given status and code.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string, fieldErrors ...FieldError) {
+	writeProblemBody(w, status, newProblem(r, status, code, detail, fieldErrors...))
+}
+
+// newProblem builds a problem for r. Handlers that add extension members
+// embed it in their own struct and send it with writeProblemBody.
+func newProblem(r *http.Request, status int, code, detail string, fieldErrors ...FieldError) Problem {
+	problem := Problem{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Code:     code,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Errors:   fieldErrors,
+	}
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		problem.RequestID = id
+	}
+	return problem
+}
+
+func writeProblemBody(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeInternalError reports a failure the client cannot fix. The cause must
+// already have been logged; the request ID ties the response to the log.
+func writeInternalError(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusInternalServerError, codeInternalError,
+		"The server failed to complete the request")
+}
+
+// writeValidationError reports invalid request fields with 422.
+func writeValidationError(w http.ResponseWriter, r *http.Request, fieldErrors []FieldError) {
+	writeProblem(w, r, http.StatusUnprocessableEntity, codeValidationFailed,
+		"The request contains invalid fields", fieldErrors...)
+}
+
+// writeDecodeError reports a request body that could not be decoded: 413
+// when it exceeded the limit set by limitBody, otherwise 400.
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+			"The request body is larger than the limit")
+		return
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		writeValidationError(w, r, []FieldError{{
+			Field:   typeErr.Field,
+			Code:    fieldInvalid,
+			Message: "must be a JSON " + jsonTypeName(typeErr.Type.Kind()),
+		}})
+		return
+	}
+	writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "The request body is not valid JSON")
+}
+
+// jsonTypeName maps a Go kind to the JSON type a client should send.
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "number"
+}
+
+// writeTaskNotFound reports that no task has the requested ID.
+func writeTaskNotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusNotFound, codeTaskNotFound, "Task not found")
+}
+
+// writeInvalidID reports a malformed task ID in the URL path.
+func writeInvalidID(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusBadRequest, codeInvalidID, "Task ID must be an integer")
+}
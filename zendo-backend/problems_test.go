@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	c := newTestClient(t)
+	saved := config.Limits.MaxBodyBytes
+	config.Limits.MaxBodyBytes = 128
+	t.Cleanup(func() { config.Limits.MaxBodyBytes = saved })
+	c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+
+	for _, tc := range []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+		field                    string
+	}{
+		{"malformed JSON", "POST", "/api/tasks", `{"title":`, http.StatusBadRequest, codeInvalidJSON, ""},
+		{"wrong field type", "POST", "/api/tasks", `{"title":7,"dayOfWeek":"monday","weekDate":"2024-01-07"}`, http.StatusUnprocessableEntity, codeValidationFailed, "title"},
+		{"missing title", "POST", "/api/tasks", `{"dayOfWeek":"monday","weekDate":"2024-01-07"}`, http.StatusUnprocessableEntity, codeValidationFailed, "title"},
+		{"body too large", "POST", "/api/tasks", `{"title":"` + strings.Repeat("x", 200) + `"}`, http.StatusRequestEntityTooLarge, codePayloadTooLarge, ""},
+		{"invalid ID", "GET", "/api/tasks/abc", "", http.StatusBadRequest, codeInvalidID, ""},
+		{"unknown task", "GET", "/api/tasks/999", "", http.StatusNotFound, codeTaskNotFound, ""},
+		{"unknown comment", "DELETE", "/api/tasks/1/comments/999", "", http.StatusNotFound, codeCommentNotFound, ""},
+		{"unknown API path", "GET", "/api/nope", "", http.StatusNotFound, codeNotFound, ""},
+		{"unknown task list", "GET", "/api/tasks/1/bogus", "", http.StatusNotFound, codeNotFound, ""},
+		{"unknown method", "PATCH", "/api/tasks/1", "", http.StatusMethodNotAllowed, codeMethodNotAllowed, ""},
+		{"wrong method", "GET", "/api/undo", "", http.StatusMethodNotAllowed, codeMethodNotAllowed, ""},
+	} {
+		req, err := http.NewRequest(tc.method, c.server.URL+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var problem Problem
+		err = json.NewDecoder(resp.Body).Decode(&problem)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("%s: decoding problem: %v", tc.name, err)
+			continue
+		}
+		if got := resp.Header.Get("Content-Type"); got != "application/problem+json" {
+			t.Errorf("%s: Content-Type = %q", tc.name, got)
+		}
+		if resp.StatusCode != tc.status || problem.Status != tc.status || problem.Code != tc.code ||
+			problem.Type != problemTypePrefix+tc.code || problem.Title != http.StatusText(tc.status) || problem.Instance != tc.path {
+			t.Errorf("%s: status %d, problem %+v; want %d %s", tc.name, resp.StatusCode, problem, tc.status, tc.code)
+		}
+		if tc.status == http.StatusMethodNotAllowed && resp.Header.Get("Allow") == "" {
+			t.Errorf("%s: no Allow header", tc.name)
+		}
+		if tc.field != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != tc.field) {
+			t.Errorf("%s: field errors %+v, want one for %s", tc.name, problem.Errors, tc.field)
+		}
+	}
+
+	// The request ID set by logRequests is echoed so a report can be found
+	// in the log.
+	r := httptest.NewRequest("GET", "/api/tasks/1", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "req-1"))
+	w := httptest.NewRecorder()
+	writeInternalError(w, r)
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusInternalServerError || problem.Code != codeInternalError || problem.RequestID != "req-1" {
+		t.Errorf("internal error: status %d, problem %+v", w.Code, problem)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q", got)
+	}
+}
+
+func TestUnknownAPIRoutes(t *testing.T) {
+	c := newTestClient(t)
+
+	for path, want := range map[string]string{
+		"/api/tasks/1":          "GET, PUT, DELETE",
+		"/api/tasks":            "GET, POST",
+		"/api/undo":             "POST",
+		"/api/tasks/1/move":     "POST",
+		"/api/tasks/1/comments": "GET, POST",
+	} {
+		req, err := http.NewRequest("PATCH", c.server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Allow"); resp.StatusCode != http.StatusMethodNotAllowed || got != want {
+			t.Errorf("PATCH %s: status %d, Allow %q; want 405 with %q", path, resp.StatusCode, got, want)
+		}
+	}
+
+	// Everything outside the API is still the frontend.
+	resp, err := http.Get(c.server.URL + "/some/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); strings.Contains(got, "problem") {
+		t.Errorf("frontend route answered with %s", got)
+	}
+}
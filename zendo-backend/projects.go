@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Projects group tasks above tags: a task belongs to at most one project,
+// stored in tasks.project_id. Archiving a project only marks it as done with;
+// its tasks are kept and can still be assigned to it. Deleting a project
+// takes its tasks out of it.
+
+// Project is a named group of tasks. Progress counts its tasks outside the
+// trash.
+type Project struct {
+	ID         int             `json:"id"`
+	Name       string          `json:"name"`
+	Color      string          `json:"color"` // #rrggbb, or empty
+	Archived   bool            `json:"archived"`
+	TargetDate string          `json:"targetDate,omitempty"` // YYYY-MM-DD
+	Progress   ProjectProgress `json:"progress"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+}
+
+// ProjectProgress counts the completed and all tasks of a project.
+type ProjectProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// ProjectRequest is the body of POST and PUT /api/projects. An update
+// replaces every field.
+type ProjectRequest struct {
+	Name       string `json:"name"`
+	Color      string `json:"color"`
+	Archived   bool   `json:"archived"`
+	TargetDate string `json:"targetDate,omitempty"`
+}
+
+var projectColorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// validate normalizes the request and checks the format of its fields.
+func (p *ProjectRequest) validate() []FieldError {
+	var fieldErrors []FieldError
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Code: fieldRequired, Message: "is required"})
+	} else if n := utf8.RuneCountInString(p.Name); n > maxProjectNameLength {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Code: fieldTooLong, Message: fmt.Sprintf("must be at most %d characters, got %d", maxProjectNameLength, n)})
+	}
+	p.Color = strings.ToLower(strings.TrimSpace(p.Color))
+	if p.Color != "" && !projectColorPattern.MatchString(p.Color) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "color", Code: fieldInvalid, Message: "must be a hex colour such as \"#3b82f6\""})
+	}
+	p.TargetDate = strings.TrimSpace(p.TargetDate)
+	if p.TargetDate != "" {
+		if _, err := time.ParseInLocation("2006-01-02", p.TargetDate, timezone); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: "targetDate", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+		}
+	}
+	return fieldErrors
+}
+
+// projectOf returns the project of a task for taskFields, with 0 for none so
+// that saving the fields takes the task out of any project.
+func projectOf(task *Task) *int {
+	id := 0
+	if task.ProjectID != nil {
+		id = *task.ProjectID
+	}
+	return &id
+}
+
+// projectColumn converts a project ID from taskFields to the project_id
+// column, where no project is NULL.
+func projectColumn(id *int) interface{} {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	return *id
+}
+
+func projectExists(ctx context.Context, q queryer, id int) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM projects WHERE id = ?", id).Scan(&n)
+	return n > 0, err
+}
+
+// checkProject rejects a project ID in a task request that names no
+// project.
+func checkProject(ctx context.Context, q queryer, id *int) ([]FieldError, error) {
+	if id == nil || *id == 0 {
+		return nil, nil
+	}
+	exists, err := projectExists(ctx, q, *id)
+	if err != nil || exists {
+		return nil, err
+	}
+	return []FieldError{{Field: "projectId", Code: fieldInvalid, Message: "is not an existing project"}}, nil
+}
+
+// existingProject replaces the project of an earlier task state with none
+// when the project has been deleted since.
+func existingProject(ctx context.Context, q queryer, id *int) (*int, error) {
+	if id == nil || *id == 0 {
+		return id, nil
+	}
+	exists, err := projectExists(ctx, q, *id)
+	if err != nil || exists {
+		return id, err
+	}
+	none := 0
+	return &none, nil
+}
+
+// parseProjectFilter reads the project query parameter of the task lists: a
+// project ID, or "none" for tasks without a project. It returns a condition
+// starting with " AND".
+func parseProjectFilter(query url.Values) (string, []interface{}, []FieldError) {
+	s := strings.TrimSpace(query.Get("project"))
+	if s == "" {
+		return "", nil, nil
+	}
+	if strings.EqualFold(s, "none") {
+		return " AND project_id IS NULL", nil, nil
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return "", nil, []FieldError{{Field: "project", Code: fieldInvalid, Message: "must be a project ID or none"}}
+	}
+	return " AND project_id = ?", []interface{}{id}, nil
+}
+
+const projectColumns = `p.id, p.name, p.color, p.archived, p.target_date, p.created_at, p.updated_at,
+	COUNT(t.id), COALESCE(SUM(t.completed), 0)`
+
+// queryProjects returns the projects matching a WHERE clause on p, active
+// ones first and then by name, with their progress.
+func queryProjects(ctx context.Context, q queryer, where string, args ...interface{}) ([]Project, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+projectColumns+` FROM projects p
+		LEFT JOIN tasks t ON t.project_id = p.id AND t.deleted_at IS NULL
+		WHERE `+where+` GROUP BY p.id ORDER BY p.archived, p.name COLLATE NOCASE, p.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	projects := []Project{}
+	for rows.Next() {
+		var p Project
+		var targetDate sql.NullString
+		if err := rows.Scan(&p.ID, &p.Name, &p.Color, &p.Archived, &targetDate, &p.CreatedAt, &p.UpdatedAt, &p.Progress.Total, &p.Progress.Done); err != nil {
+			return nil, err
+		}
+		p.TargetDate = targetDate.String
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// loadProject returns sql.ErrNoRows when the project does not exist.
+func loadProject(ctx context.Context, q queryer, id int) (Project, error) {
+	projects, err := queryProjects(ctx, q, "p.id = ?", id)
+	if err != nil {
+		return Project{}, err
+	}
+	if len(projects) == 0 {
+		return Project{}, sql.ErrNoRows
+	}
+	return projects[0], nil
+}
+
+// projectNameTaken reports whether another project has the name, ignoring
+// case.
+func projectNameTaken(ctx context.Context, q queryer, name string, self int) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM projects WHERE name = ? COLLATE NOCASE AND id != ?", name, self).Scan(&n)
+	return n > 0, err
+}
+
+func insertProject(ctx context.Context, q queryer, req ProjectRequest) (Project, error) {
+	result, err := q.ExecContext(ctx, "INSERT INTO projects (name, color, archived, target_date) VALUES (?, ?, ?, ?)",
+		req.Name, req.Color, req.Archived, nullableString(req.TargetDate))
+	if err != nil {
+		return Project{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Project{}, err
+	}
+	return loadProject(ctx, q, int(id))
+}
+
+// nullableString stores an empty string as NULL.
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// unassignProject takes every task out of a project, recording the change
+// for tasks outside the trash. It returns how many tasks were changed.
+func unassignProject(ctx context.Context, q queryer, projectID int) (int, error) {
+	tasks, err := queryTasks(ctx, q, "project_id = ?", projectID)
+	if err != nil {
+		return 0, err
+	}
+	for _, task := range tasks {
+		fields := fieldsOf(&task)
+		none := 0
+		fields.ProjectID = &none
+		if _, err := saveTask(ctx, q, task.ID, fields, task.Completed); err != nil {
+			return 0, err
+		}
+	}
+	_, err = q.ExecContext(ctx, "UPDATE tasks SET project_id = NULL WHERE project_id = ?", projectID)
+	return len(tasks), err
+}
+
+// projectsFromTags moves tasks from tags into projects named after them.
+// Only the given tags are migrated, or every tag when none are given. Each
+// task without a project moves to the project of its first migrated tag,
+// which is created unless a project of that name exists, and loses that tag
+// unless keepTags is set. Tasks in the trash are left alone. A dry run
+// reports the counts without writing anything.
+func projectsFromTags(ctx context.Context, tags []string, keepTags, dryRun bool) (created, moved int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	wanted := make(map[string]bool)
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			wanted[strings.ToLower(tag)] = true
+		}
+	}
+
+	projects, err := queryProjects(ctx, tx, "1")
+	if err != nil {
+		return 0, 0, err
+	}
+	projectIDs := make(map[string]int)
+	for _, p := range projects {
+		if _, ok := projectIDs[strings.ToLower(p.Name)]; !ok {
+			projectIDs[strings.ToLower(p.Name)] = p.ID
+		}
+	}
+
+	tasks, err := queryTasks(ctx, tx, "project_id IS NULL AND tags != ''")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, task := range tasks {
+		taskTags := strings.Split(task.Tags, ",")
+		index := -1
+		for i, tag := range taskTags {
+			if key := strings.ToLower(tag); len(wanted) == 0 || wanted[key] {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			continue
+		}
+
+		tag := taskTags[index]
+		id, ok := projectIDs[strings.ToLower(tag)]
+		if !ok {
+			req := ProjectRequest{Name: tag}
+			if fieldErrors := req.validate(); len(fieldErrors) > 0 {
+				slog.Warn("Tag cannot be a project name", "tag", tag, "errors", fieldErrors)
+				projectIDs[strings.ToLower(tag)] = 0
+				continue
+			}
+			project, err := insertProject(ctx, tx, req)
+			if err != nil {
+				return 0, 0, err
+			}
+			id = project.ID
+			projectIDs[strings.ToLower(tag)] = id
+			created++
+			slog.Info("Created project from tag", "project_id", id, "name", project.Name)
+		}
+		if id == 0 {
+			continue
+		}
+
+		fields := fieldsOf(&task)
+		fields.ProjectID = &id
+		if !keepTags {
+			fields.Tags = strings.Join(append(taskTags[:index:index], taskTags[index+1:]...), ",")
+		}
+		if _, err := saveTask(ctx, tx, task.ID, fields, task.Completed); err != nil {
+			return 0, 0, err
+		}
+		moved++
+	}
+
+	if dryRun {
+		return created, moved, nil
+	}
+	return created, moved, tx.Commit()
+}
+
+// pathProject loads the project named by the path, writing the problem
+// response when it does not exist.
+func pathProject(w http.ResponseWriter, r *http.Request) (Project, bool) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid project ID", "id", idStr, "error", err)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidID, "Project ID must be an integer")
+		return Project{}, false
+	}
+
+	project, err := loadProject(r.Context(), db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Project not found", "project_id", id)
+		writeProblem(w, r, http.StatusNotFound, codeProjectNotFound, "Project not found")
+		return Project{}, false
+	}
+	if err != nil {
+		logger.Error("Database query failed", "project_id", id, "error", err)
+		writeInternalError(w, r)
+		return Project{}, false
+	}
+	return project, true
+}
+
+// decodeProjectRequest reads and validates the body of a create or update,
+// writing the problem response when it is invalid. self is the project
+// being updated, or 0.
+func decodeProjectRequest(w http.ResponseWriter, r *http.Request, self int) (ProjectRequest, bool) {
+	logger := requestLogger(r)
+
+	var req ProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return req, false
+	}
+	fieldErrors := req.validate()
+	if req.Name != "" {
+		taken, err := projectNameTaken(r.Context(), db, req.Name, self)
+		if err != nil {
+			logger.Error("Database query failed", "error", err)
+			writeInternalError(w, r)
+			return req, false
+		}
+		if taken {
+			fieldErrors = append(fieldErrors, FieldError{Field: "name", Code: fieldInvalid, Message: "is already used by another project"})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		logger.Warn("Project validation failed", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return req, false
+	}
+	return req, true
+}
+
+// listProjects returns the projects with their progress, active ones first.
+// The archived query parameter keeps only archived or only active projects.
+func listProjects(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	where, args := "1", []interface{}(nil)
+	if s := r.URL.Query().Get("archived"); s != "" {
+		archived, err := strconv.ParseBool(s)
+		if err != nil {
+			writeInvalidFilters(w, r, []FieldError{{Field: "archived", Code: fieldInvalid, Message: "must be true or false"}})
+			return
+		}
+		where, args = "p.archived = ?", []interface{}{archived}
+	}
+
+	projects, err := queryProjects(r.Context(), db, where, args...)
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projects)
+}
+
+func getProject(w http.ResponseWriter, r *http.Request) {
+	project, ok := pathProject(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+func createProject(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	req, ok := decodeProjectRequest(w, r, 0)
+	if !ok {
+		return
+	}
+
+	project, err := insertProject(r.Context(), db, req)
+	if err != nil {
+		logger.Error("Database insert failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Project created", "project_id", project.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(project)
+}
+
+func updateProject(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	project, ok := pathProject(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeProjectRequest(w, r, project.ID)
+	if !ok {
+		return
+	}
+
+	_, err := db.ExecContext(r.Context(), "UPDATE projects SET name = ?, color = ?, archived = ?, target_date = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		req.Name, req.Color, req.Archived, nullableString(req.TargetDate), project.ID)
+	if err == nil {
+		project, err = loadProject(r.Context(), db, project.ID)
+	}
+	if err != nil {
+		logger.Error("Database update failed", "project_id", project.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Project updated", "project_id", project.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// deleteProject deletes a project after taking its tasks out of it.
+func deleteProject(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	project, ok := pathProject(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	unassigned, err := unassignProject(r.Context(), tx, project.ID)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "DELETE FROM projects WHERE id = ?", project.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Database delete failed", "project_id", project.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Project deleted", "project_id", project.ID, "unassigned_tasks", unassigned)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Project deleted successfully"})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestProjects(t *testing.T) {
+	c := newTestClient(t)
+
+	status, data := c.call("POST", "/api/projects", `{"name":"Launch","color":"#3B82F6","targetDate":"2024-02-01"}`)
+	var project Project
+	c.decode(data, &project)
+	if status != http.StatusCreated || project.Color != "#3b82f6" || project.TargetDate != "2024-02-01" {
+		t.Fatalf("create project: status %d, body %s", status, data)
+	}
+	if status, _ := c.call("POST", "/api/projects", `{"name":"launch"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("duplicate name: status %d, want 422", status)
+	}
+
+	create := func(body string) Task {
+		t.Helper()
+		_, data := c.call("POST", "/api/tasks", body)
+		var task Task
+		c.decode(data, &task)
+		return task
+	}
+	a := create(fmt.Sprintf(`{"title":"A","dayOfWeek":"monday","weekDate":"2024-01-07","projectId":%d}`, project.ID))
+	create(`{"title":"B","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	if status, _ := c.call("POST", "/api/tasks", `{"title":"C","dayOfWeek":"monday","weekDate":"2024-01-07","projectId":999}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("unknown project: status %d, want 422", status)
+	}
+
+	if got := c.titles(fmt.Sprintf("/api/tasks/week/2024-01-07?project=%d", project.ID)); got != "A" {
+		t.Errorf("week in project = %s, want A", got)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07?project=none"); got != "B" {
+		t.Errorf("week without project = %s, want B", got)
+	}
+
+	// An update without projectId keeps the project.
+	path := fmt.Sprintf("/api/tasks/%d", a.ID)
+	c.call("PUT", path, `{"title":"A","completed":true,"dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	_, data = c.call("GET", fmt.Sprintf("/api/projects/%d", project.ID), "")
+	c.decode(data, &project)
+	if project.Progress != (ProjectProgress{Done: 1, Total: 1}) {
+		t.Errorf("progress = %+v, want 1 of 1 done", project.Progress)
+	}
+
+	c.call("DELETE", fmt.Sprintf("/api/projects/%d", project.ID), "")
+	_, data = c.call("GET", path, "")
+	var task Task
+	c.decode(data, &task)
+	if task.ProjectID != nil {
+		t.Errorf("task of a deleted project has projectId %d", *task.ProjectID)
+	}
+	_, data = c.call("GET", path+"/history", "")
+	var history []AuditRecord
+	c.decode(data, &history)
+	if len(history) == 0 || history[0].Changes["projectId"].From == nil {
+		t.Errorf("history after project delete = %s", data)
+	}
+
+	create(`{"title":"D","dayOfWeek":"tuesday","weekDate":"2024-01-07","tags":"home,Errands"}`)
+	create(`{"title":"E","dayOfWeek":"tuesday","weekDate":"2024-01-07","tags":"errands"}`)
+	created, moved, err := projectsFromTags(context.Background(), []string{"errands"}, false, false)
+	if err != nil || created != 1 || moved != 2 {
+		t.Fatalf("projectsFromTags = %d, %d, %v; want 1, 2", created, moved, err)
+	}
+	_, data = c.call("GET", "/api/projects", "")
+	var projects []Project
+	c.decode(data, &projects)
+	if len(projects) != 1 || projects[0].Name != "Errands" || projects[0].Progress.Total != 2 {
+		t.Fatalf("projects after migration = %s", data)
+	}
+	_, data = c.call("GET", fmt.Sprintf("/api/tasks/week/2024-01-07?project=%d", projects[0].ID), "")
+	var tasks []Task
+	c.decode(data, &tasks)
+	if len(tasks) != 2 || tasks[0].Tags != "home" || tasks[1].Tags != "" {
+		t.Errorf("migrated tasks = %s", data)
+	}
+}
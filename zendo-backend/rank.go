@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+)
+
+// Task positions are fractional ranks: strings of rankDigits compared
+// byte-wise, read as the digits of a number between 0 and 1. A key between
+// any two others can always be made, so a reorder rewrites a single row.
+// Keys never end in the zero digit, which keeps room below every key.
+const rankDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxRankLength is the key length beyond which a day is rebalanced. Keys
+// grow by about one digit per six appends to the same day, or per six
+// inserts into the same gap.
+const maxRankLength = 16
+
+// rankBetween returns a key that sorts strictly between a and b. An empty a
+// means the start of the day and an empty b the end; a must sort before b.
+func rankBetween(a, b string) string {
+	if b != "" {
+		// Keep the common prefix, reading a as padded with zeros.
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + rankBetween(rankTail(a, n), b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(rankDigits, a[0])
+	}
+	digitB := len(rankDigits)
+	if b != "" {
+		digitB = strings.IndexByte(rankDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(rankDigits[(digitA+digitB+1)/2])
+	}
+	// The first digits are adjacent: b's first digit alone is between a and b
+	// if b continues, otherwise keep a's digit and go after the rest of a.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(rankDigits[digitA]) + rankBetween(rankTail(a, 1), "")
+}
+
+func rankDigitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return rankDigits[0]
+}
+
+func rankTail(s string, n int) string {
+	if n >= len(s) {
+		return ""
+	}
+	return s[n:]
+}
+
+// spacedRanks returns n ascending keys of equal length spread evenly over
+// the key space, leaving wide gaps for later inserts.
+func spacedRanks(n int) []string {
+	base := int64(len(rankDigits))
+	width, space := 1, base
+	for space < base*int64(n+1) {
+		width++
+		space *= base
+	}
+
+	ranks := make([]string, n)
+	digits := make([]byte, width)
+	for i := range ranks {
+		value := space * int64(i+1) / int64(n+1)
+		for j := width - 1; j >= 0; j-- {
+			digits[j] = rankDigits[value%base]
+			value /= base
+		}
+		ranks[i] = strings.TrimRight(string(digits), rankDigits[:1])
+	}
+	return ranks
+}
+
+// rebalanceDay gives the tasks of one day evenly spaced positions, keeping
+// their order. Tasks without a position follow in creation order.
+func rebalanceDay(ctx context.Context, q queryer, weekDate, dayOfWeek string) error {
+	rows, err := q.QueryContext(ctx, "SELECT id FROM tasks WHERE week_date = ? AND day_of_week = ? ORDER BY position = '', position, created_at, id", weekDate, dayOfWeek)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for i, rank := range spacedRanks(len(ids)) {
+		if _, err := q.ExecContext(ctx, "UPDATE tasks SET position = ? WHERE id = ?", rank, ids[i]); err != nil {
+			return err
+		}
+	}
+	slog.Debug("Rebalanced task positions", "week", weekDate, "day", dayOfWeek, "tasks", len(ids))
+	return nil
+}
+
+// assignMissingPositions rebalances every day that has tasks without a
+// position, such as rows written before positions existed or restored from
+// an older snapshot.
+func assignMissingPositions(ctx context.Context, q queryer) (int, error) {
+	rows, err := q.QueryContext(ctx, "SELECT DISTINCT week_date, day_of_week FROM tasks WHERE position = '' OR position IS NULL")
+	if err != nil {
+		return 0, err
+	}
+	var days [][2]string
+	for rows.Next() {
+		var weekDate, dayOfWeek sql.NullString
+		if err := rows.Scan(&weekDate, &dayOfWeek); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		days = append(days, [2]string{weekDate.String, dayOfWeek.String})
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, day := range days {
+		if err := rebalanceDay(ctx, q, day[0], day[1]); err != nil {
+			return 0, err
+		}
+	}
+	return len(days), nil
+}
+
+// lastPosition returns the key to append a task to a day, rebalancing the
+// day first when the key would grow too long.
+func lastPosition(ctx context.Context, q queryer, weekDate, dayOfWeek string) (string, error) {
+	for rebalanced := false; ; rebalanced = true {
+		var last sql.NullString
+		err := q.QueryRowContext(ctx, "SELECT MAX(position) FROM tasks WHERE week_date = ? AND day_of_week = ?", weekDate, dayOfWeek).Scan(&last)
+		if err != nil {
+			return "", err
+		}
+		rank := rankBetween(last.String, "")
+		if len(rank) <= maxRankLength || rebalanced {
+			return rank, nil
+		}
+		if err := rebalanceDay(ctx, q, weekDate, dayOfWeek); err != nil {
+			return "", err
+		}
+	}
+}
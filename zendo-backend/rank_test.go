@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func checkRank(t *testing.T, a, b, rank string) {
+	t.Helper()
+	if rank <= a || (b != "" && rank >= b) {
+		t.Fatalf("rankBetween(%q, %q) = %q, not between", a, b, rank)
+	}
+	if strings.HasSuffix(rank, rankDigits[:1]) {
+		t.Fatalf("rankBetween(%q, %q) = %q ends in the zero digit", a, b, rank)
+	}
+}
+
+func TestRankBetween(t *testing.T) {
+	for _, tc := range [][2]string{{"", ""}, {"", "1"}, {"", "01"}, {"V", ""}, {"z", ""}, {"zz", ""}, {"V", "W"}, {"V", "V1"}, {"A1", "A2"}, {"Az", "B"}} {
+		checkRank(t, tc[0], tc[1], rankBetween(tc[0], tc[1]))
+	}
+
+	// Random inserts into one list must keep every key distinct and ordered.
+	r := rand.New(rand.NewSource(1))
+	keys := []string{}
+	for i := 0; i < 2000; i++ {
+		at := r.Intn(len(keys) + 1)
+		a, b := "", ""
+		if at > 0 {
+			a = keys[at-1]
+		}
+		if at < len(keys) {
+			b = keys[at]
+		}
+		rank := rankBetween(a, b)
+		checkRank(t, a, b, rank)
+		keys = append(keys[:at], append([]string{rank}, keys[at:]...)...)
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Fatal("keys are not sorted")
+	}
+}
+
+func TestSpacedRanks(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 61, 62, 500, 10000} {
+		ranks := spacedRanks(n)
+		if len(ranks) != n {
+			t.Fatalf("spacedRanks(%d) returned %d keys", n, len(ranks))
+		}
+		for i, rank := range ranks {
+			if rank == "" || strings.HasSuffix(rank, rankDigits[:1]) {
+				t.Fatalf("spacedRanks(%d)[%d] = %q", n, i, rank)
+			}
+			if i > 0 && ranks[i-1] >= rank {
+				t.Fatalf("spacedRanks(%d): %q does not sort after %q", n, rank, ranks[i-1])
+			}
+			checkRank(t, rank, "", rankBetween(rank, ""))
+		}
+	}
+}
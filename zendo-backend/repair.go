@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+)
+
+// storedTask is a tasks row as read by repairTasks. Columns may be NULL in
+// rows written before validation existed.
+type storedTask struct {
+	id        int
+	title     sql.NullString
+	dayOfWeek sql.NullString
+	weekDate  sql.NullString
+	tags      sql.NullString
+	createdAt sql.NullTime
+}
+
+// repairTasks rewrites task rows into the canonical form enforced by the API.
+// A week date that cannot be parsed is replaced by the week the task was
+// created in. A task that ends up on another day is appended to that day.
+// Rows that still fail validation, such as an unknown day name, are logged
+// and left unchanged for manual repair. updated_at is not touched.
+func repairTasks(dryRun bool) (repaired, unrepairable int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, title, day_of_week, week_date, tags, created_at FROM tasks ORDER BY id")
+	if err != nil {
+		return 0, 0, err
+	}
+	var tasks []storedTask
+	for rows.Next() {
+		var t storedTask
+		if err := rows.Scan(&t.id, &t.title, &t.dayOfWeek, &t.weekDate, &t.tags, &t.createdAt); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, t := range tasks {
+		fields := taskFields{
+			Title:     t.title.String,
+			DayOfWeek: t.dayOfWeek.String,
+			WeekDate:  t.weekDate.String,
+			Tags:      t.tags.String,
+		}
+
+		var remaining []FieldError
+		for _, fieldErr := range fields.normalize() {
+			if fieldErr.Field == "weekDate" && t.createdAt.Valid {
+				fields.WeekDate = getWeekStart(t.createdAt.Time.In(timezone)).Format("2006-01-02")
+				continue
+			}
+			remaining = append(remaining, fieldErr)
+		}
+		if len(remaining) > 0 {
+			slog.Warn("Cannot repair task", "task_id", t.id, "errors", remaining)
+			unrepairable++
+			continue
+		}
+
+		if fields.Title == t.title.String && fields.DayOfWeek == t.dayOfWeek.String &&
+			fields.WeekDate == t.weekDate.String && fields.Tags == t.tags.String && t.tags.Valid {
+			continue
+		}
+
+		slog.Info("Repairing task", "task_id", t.id,
+			"dayOfWeek", t.dayOfWeek.String+" -> "+fields.DayOfWeek,
+			"weekDate", t.weekDate.String+" -> "+fields.WeekDate,
+			"tags", t.tags.String+" -> "+fields.Tags)
+		repaired++
+		if dryRun {
+			continue
+		}
+		_, err := tx.Exec("UPDATE tasks SET title = ?, day_of_week = ?, week_date = ?, tags = ? WHERE id = ?",
+			fields.Title, fields.DayOfWeek, fields.WeekDate, fields.Tags, t.id)
+		if err != nil {
+			return 0, 0, err
+		}
+		if fields.DayOfWeek != t.dayOfWeek.String || fields.WeekDate != t.weekDate.String {
+			position, err := lastPosition(context.Background(), tx, fields.WeekDate, fields.DayOfWeek)
+			if err != nil {
+				return 0, 0, err
+			}
+			if _, err := tx.Exec("UPDATE tasks SET position = ? WHERE id = ?", position, t.id); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	if dryRun {
+		return repaired, unrepairable, nil
+	}
+	return repaired, unrepairable, tx.Commit()
+}
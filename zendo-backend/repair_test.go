@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestRepairTasks(t *testing.T) {
+	c := newTestClient(t)
+
+	c.call("POST", "/api/tasks", `{"title":"Existing","dayOfWeek":"tuesday","weekDate":"2024-01-07"}`)
+	existing := c.task(1)
+	for _, row := range []struct {
+		title, day, week string
+		tags, createdAt  any
+	}{
+		{" Padded ", "Tue", "2024-01-10", " b, a ,B", "2024-01-09 10:00:00"},
+		{"Lost week", "tuesday", "someday", nil, "2024-01-09 10:00:00"},
+		{"No creation date", "tuesday", "someday", "", nil},
+		{"Unknown day", "someday", "2024-02-04", "", "2024-01-09 10:00:00"},
+	} {
+		_, err := db.Exec("INSERT INTO tasks (title, day_of_week, week_date, tags, created_at) VALUES (?, ?, ?, ?, ?)",
+			row.title, row.day, row.week, row.tags, row.createdAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repaired, unrepairable, err := repairTasks(true)
+	if err != nil || repaired != 2 || unrepairable != 2 {
+		t.Fatalf("dry run = %d repaired, %d unrepairable, %v; want 2, 2", repaired, unrepairable, err)
+	}
+	var title string
+	db.QueryRow("SELECT title FROM tasks WHERE id = 2").Scan(&title)
+	if title != " Padded " {
+		t.Errorf("dry run changed title to %q", title)
+	}
+
+	repaired, unrepairable, err = repairTasks(false)
+	if err != nil || repaired != 2 || unrepairable != 2 {
+		t.Fatalf("repair = %d repaired, %d unrepairable, %v; want 2, 2", repaired, unrepairable, err)
+	}
+
+	padded, lost := c.task(2), c.task(3)
+	if padded.Title != "Padded" || padded.DayOfWeek != "tuesday" || padded.WeekDate != "2024-01-07" || padded.Tags != "b,a" {
+		t.Errorf("repaired task = %+v", padded)
+	}
+	if lost.WeekDate != "2024-01-07" {
+		t.Errorf("task with a bad week date = %+v, want the week it was created in", lost)
+	}
+	// Repaired tasks are appended to the day they moved to.
+	if !(existing.Position < padded.Position && padded.Position < lost.Position) {
+		t.Errorf("positions = %q, %q, %q; want increasing", existing.Position, padded.Position, lost.Position)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "Existing,Padded,Lost week" {
+		t.Errorf("week after repair = %s", got)
+	}
+
+	var week sql.NullString
+	db.QueryRow("SELECT week_date FROM tasks WHERE id = 4").Scan(&week)
+	if week.String != "someday" {
+		t.Errorf("task without a creation date got week %q, want it left alone", week.String)
+	}
+
+	if repaired, _, err := repairTasks(false); err != nil || repaired != 0 {
+		t.Errorf("second repair = %d repaired, %v; want nothing to do", repaired, err)
+	}
+}
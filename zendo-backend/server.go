@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTP server limits. The write timeout is generous because backups and CSV
+// exports are streamed in a single response. Handlers that take large bodies
+// get uploadTimeout instead of the read and write timeouts, see
+// allowSlowUpload.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 2 * time.Minute
+	idleTimeout       = 2 * time.Minute
+	maxHeaderBytes    = 64 << 10
+	uploadTimeout     = 30 * time.Minute
+
+	// shutdownTimeout bounds how long in-flight requests and background
+	// jobs may take to finish after SIGTERM or SIGINT.
+	shutdownTimeout = 15 * time.Second
+)
+
+// backgroundJobs tracks goroutines, such as scheduled backups, that must
+// finish before the database is closed.
+var backgroundJobs sync.WaitGroup
+
+// newHTTPServer returns a server for handler with hardened timeouts.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// allowSlowUpload extends the read and write deadlines of the connection to
+// uploadTimeout for next, so attachment uploads and restores are not cut off
+// by the server-wide timeouts on slow links. Their size is still capped.
+func allowSlowUpload(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		deadline := time.Now().Add(uploadTimeout)
+		if err := rc.SetReadDeadline(deadline); err != nil {
+			requestLogger(r).Debug("Cannot extend the read deadline", "error", err)
+		}
+		if err := rc.SetWriteDeadline(deadline); err != nil {
+			requestLogger(r).Debug("Cannot extend the write deadline", "error", err)
+		}
+		next(w, r)
+	}
+}
+
+// shutdown stops accepting requests on every server, waits for in-flight
+// requests and background jobs until ctx expires, then closes the database.
+func shutdown(ctx context.Context, servers ...*http.Server) {
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("HTTP server shutdown failed", "listen", server.Addr, "error", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		backgroundJobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Timed out waiting for background jobs")
+	}
+
+	closeDatabase()
+}
+
+// closeDatabase checkpoints the write-ahead log into the main database file
+// and closes the connection pool.
+func closeDatabase() {
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		slog.Error("WAL checkpoint failed", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
+		return
+	}
+	slog.Info("Database closed")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAllowSlowUpload(t *testing.T) {
+	readBody := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+	// slowPost sends a body in chunks spread over longer than the server's
+	// read timeout.
+	slowPost := func(url string) (int, error) {
+		body, writer := io.Pipe()
+		go func() {
+			for i := 0; i < 4; i++ {
+				time.Sleep(100 * time.Millisecond)
+				writer.Write([]byte(strings.Repeat("x", 1024)))
+			}
+			writer.Close()
+		}()
+		resp, err := http.Post(url, "application/octet-stream", body)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		ok      bool
+	}{
+		{"server timeouts", readBody, false},
+		{"slow upload allowed", allowSlowUpload(readBody), true},
+	} {
+		server := httptest.NewUnstartedServer(tc.handler)
+		server.Config.ReadTimeout = 200 * time.Millisecond
+		server.Start()
+		status, err := slowPost(server.URL)
+		server.Close()
+		if ok := err == nil && status == http.StatusOK; ok != tc.ok {
+			t.Errorf("%s: status %d, error %v; want success %t", tc.name, status, err, tc.ok)
+		}
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	dir := t.TempDir()
+	if err := openDatabase(filepath.Join(dir, "zendo.db")); err != nil {
+		t.Fatalf("openDatabase: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO tasks (title, day_of_week, week_date) VALUES ('Plan', 'monday', '2024-01-07')"); err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	server := newHTTPServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	}))
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	// A background job still running at shutdown is waited for.
+	var jobDone atomic.Bool
+	backgroundJobs.Add(1)
+	go func() {
+		defer backgroundJobs.Done()
+		<-release
+		time.Sleep(50 * time.Millisecond)
+		jobDone.Store(true)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inFlight <- result{string(body), err}
+	}()
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown(ctx, server)
+		close(stopped)
+	}()
+
+	// New connections are refused while the request finishes.
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("server still accepts connections after shutdown started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	if got := <-inFlight; got.err != nil || got.body != "done" {
+		t.Errorf("in-flight request: body %q, error %v", got.body, got.err)
+	}
+	<-stopped
+	if !jobDone.Load() {
+		t.Error("shutdown returned before the background job finished")
+	}
+	if err := db.Ping(); err == nil {
+		t.Error("database still open after shutdown")
+	}
+	// The write-ahead log was checkpointed into the database file.
+	if info, err := os.Stat(filepath.Join(dir, "zendo.db-wal")); err == nil && info.Size() > 0 {
+		t.Errorf("write-ahead log has %d bytes after shutdown", info.Size())
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+)
+
+// taskColumns lists the tasks columns in the order scanTask reads them.
+const taskColumns = "id, title, description, completed, day_of_week, week_date, tags, urgent, important, position, created_at, updated_at, deleted_at, project_id"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask reads a row selected with taskColumns and derives the checklist
+// counts from the description.
+func scanTask(row rowScanner, task *Task) error {
+	var deletedAt sql.NullTime
+	var projectID sql.NullInt64
+	if err := row.Scan(&task.ID, &task.Title, &task.Description, &task.Completed, &task.DayOfWeek, &task.WeekDate, &task.Tags, &task.Urgent, &task.Important, &task.Position, &task.CreatedAt, &task.UpdatedAt, &deletedAt, &projectID); err != nil {
+		return err
+	}
+	task.DeletedAt = nil
+	if deletedAt.Valid {
+		task.DeletedAt = &deletedAt.Time
+	}
+	task.ProjectID = nil
+	if projectID.Valid {
+		id := int(projectID.Int64)
+		task.ProjectID = &id
+	}
+	task.Checklist = countChecklist(task.Description)
+	return nil
+}
+
+// queryer runs statements on the database or inside a transaction, so the
+// functions below can be shared by single and bulk requests.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// The functions below return sql.ErrNoRows when the task does not exist or
+// is in the trash. Fields must already have been validated.
+
+func loadTask(ctx context.Context, q queryer, id int) (Task, error) {
+	var task Task
+	err := scanTask(q.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = ? AND deleted_at IS NULL", id), &task)
+	return task, err
+}
+
+// insertTask adds the task at the end of its day.
+func insertTask(ctx context.Context, q queryer, fields taskFields) (Task, error) {
+	position, err := lastPosition(ctx, q, fields.WeekDate, fields.DayOfWeek)
+	if err != nil {
+		return Task{}, err
+	}
+	result, err := q.ExecContext(ctx, "INSERT INTO tasks (title, description, day_of_week, week_date, tags, urgent, important, project_id, position) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		fields.Title, fields.Description, fields.DayOfWeek, fields.WeekDate, fields.Tags, fields.Urgent, fields.Important, projectColumn(fields.ProjectID), position)
+	if err != nil {
+		return Task{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Task{}, err
+	}
+	task, err := loadTask(ctx, q, int(id))
+	if err != nil {
+		return Task{}, err
+	}
+	return task, recordChange(ctx, q, nil, &task)
+}
+
+// saveTask overwrites a task. A task that changes day goes to the end of
+// the new day; otherwise it keeps its position. Without a project in fields
+// the task keeps its own.
+func saveTask(ctx context.Context, q queryer, id int, fields taskFields, completed bool) (Task, error) {
+	before, err := loadTask(ctx, q, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if fields.ProjectID == nil {
+		fields.ProjectID = before.ProjectID
+	}
+	position, err := lastPosition(ctx, q, fields.WeekDate, fields.DayOfWeek)
+	if err != nil {
+		return Task{}, err
+	}
+	result, err := q.ExecContext(ctx, `UPDATE tasks SET title = ?, description = ?, completed = ?, day_of_week = ?, week_date = ?, tags = ?, urgent = ?, important = ?, project_id = ?,
+		position = CASE WHEN day_of_week = ? AND week_date = ? THEN position ELSE ? END,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		fields.Title, fields.Description, completed, fields.DayOfWeek, fields.WeekDate, fields.Tags, fields.Urgent, fields.Important, projectColumn(fields.ProjectID),
+		fields.DayOfWeek, fields.WeekDate, position, id)
+	if err := checkAffected(result, err); err != nil {
+		return Task{}, err
+	}
+	return reloadTask(ctx, q, &before)
+}
+
+func setTaskCompleted(ctx context.Context, q queryer, id int, completed bool) (Task, error) {
+	before, err := loadTask(ctx, q, id)
+	if err != nil {
+		return Task{}, err
+	}
+	result, err := q.ExecContext(ctx, "UPDATE tasks SET completed = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", completed, id)
+	if err := checkAffected(result, err); err != nil {
+		return Task{}, err
+	}
+	return reloadTask(ctx, q, &before)
+}
+
+// reloadTask reads a task back after an update and records what changed
+// since before.
+func reloadTask(ctx context.Context, q queryer, before *Task) (Task, error) {
+	task, err := loadTask(ctx, q, before.ID)
+	if err != nil {
+		return Task{}, err
+	}
+	return task, recordChange(ctx, q, before, &task)
+}
+
+// removeTask moves the task to the trash. Its comments, events and
+// attachments stay until the trash is purged, see trash.go.
+func removeTask(ctx context.Context, q queryer, id int) error {
+	before, err := loadTask(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	result, err := q.ExecContext(ctx, "UPDATE tasks SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", id)
+	if err := checkAffected(result, err); err != nil {
+		return err
+	}
+	return recordChange(ctx, q, &before, nil)
+}
+
+// queryTasks returns the tasks matching a WHERE clause in list order,
+// leaving out the trash.
+func queryTasks(ctx context.Context, q queryer, where string, args ...interface{}) ([]Task, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL AND ("+where+") ORDER BY position, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tasks []Task
+	for rows.Next() {
+		var task Task
+		if err := scanTask(rows, &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// checkAffected turns an update of zero rows into sql.ErrNoRows.
+func checkAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A template is a named set of tasks that can be applied to any week, such
+// as a Monday routine. Template tasks have a day of the week instead of a
+// date, so they land on the same days in whichever week the template is
+// applied to. Their subtasks are the checklist items of the description.
+
+// Template is a stored set of tasks. Tasks are in the order they are created
+// in when the template is applied.
+type Template struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name"`
+	Tasks     []TemplateTask `json:"tasks"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+// TemplateTask is a task of a template.
+type TemplateTask struct {
+	Title       string `json:"title"`
+	Description string `json:"description"` // Markdown
+	DayOfWeek   string `json:"dayOfWeek"`
+	Tags        string `json:"tags"` // Comma-separated tags
+	Urgent      bool   `json:"urgent"`
+	Important   bool   `json:"important"`
+}
+
+// TemplateRequest is the body of POST and PUT /api/templates. An update
+// replaces the name and all the tasks.
+type TemplateRequest struct {
+	Name  string         `json:"name"`
+	Tasks []TemplateTask `json:"tasks"`
+}
+
+// SaveTemplateRequest is the body of POST /api/tasks/week/{weekDate}/template.
+type SaveTemplateRequest struct {
+	Name string `json:"name"`
+}
+
+// templateWeek stands in for the week of template tasks when they are
+// validated as tasks.
+const templateWeek = "2006-01-01"
+
+// validateTemplateName normalizes a template name and checks it.
+func validateTemplateName(name *string) []FieldError {
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		return []FieldError{{Field: "name", Code: fieldRequired, Message: "is required"}}
+	}
+	if n := utf8.RuneCountInString(*name); n > maxTemplateNameLength {
+		return []FieldError{{Field: "name", Code: fieldTooLong, Message: fmt.Sprintf("must be at most %d characters, got %d", maxTemplateNameLength, n)}}
+	}
+	return nil
+}
+
+// validate normalizes the request and checks it against the configured
+// limits. A template can hold as many tasks as a bulk request.
+func (t *TemplateRequest) validate() []FieldError {
+	fieldErrors := validateTemplateName(&t.Name)
+	switch {
+	case len(t.Tasks) == 0:
+		fieldErrors = append(fieldErrors, FieldError{Field: "tasks", Code: fieldRequired, Message: "must contain at least one task"})
+	case len(t.Tasks) > config.Limits.MaxBulkOperations:
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "tasks",
+			Code:    fieldTooMany,
+			Message: fmt.Sprintf("must have at most %d tasks, got %d", config.Limits.MaxBulkOperations, len(t.Tasks)),
+		})
+	}
+	for i := range t.Tasks {
+		task := &t.Tasks[i]
+		fields := taskFields{Title: task.Title, Description: task.Description, DayOfWeek: task.DayOfWeek, WeekDate: templateWeek, Tags: task.Tags, Urgent: task.Urgent, Important: task.Important}
+		if taskErrors := fields.validate(); len(taskErrors) > 0 {
+			fieldErrors = append(fieldErrors, prefixFields(fmt.Sprintf("tasks[%d]", i), taskErrors)...)
+			continue
+		}
+		*task = TemplateTask{Title: fields.Title, Description: fields.Description, DayOfWeek: fields.DayOfWeek, Tags: fields.Tags, Urgent: fields.Urgent, Important: fields.Important}
+	}
+	return fieldErrors
+}
+
+// loadTemplate returns a template with its tasks, or sql.ErrNoRows.
+func loadTemplate(ctx context.Context, q queryer, id int) (Template, error) {
+	var t Template
+	err := q.QueryRowContext(ctx, "SELECT id, name, created_at, updated_at FROM templates WHERE id = ?", id).
+		Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return Template{}, err
+	}
+	t.Tasks, err = queryTemplateTasks(ctx, q, id)
+	return t, err
+}
+
+func queryTemplateTasks(ctx context.Context, q queryer, templateID int) ([]TemplateTask, error) {
+	rows, err := q.QueryContext(ctx, "SELECT title, description, day_of_week, tags, urgent, important FROM template_tasks WHERE template_id = ? ORDER BY id", templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tasks := []TemplateTask{}
+	for rows.Next() {
+		var task TemplateTask
+		if err := rows.Scan(&task.Title, &task.Description, &task.DayOfWeek, &task.Tags, &task.Urgent, &task.Important); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// storeTemplateTasks replaces the tasks of a template.
+func storeTemplateTasks(ctx context.Context, q queryer, templateID int, tasks []TemplateTask) error {
+	if _, err := q.ExecContext(ctx, "DELETE FROM template_tasks WHERE template_id = ?", templateID); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		_, err := q.ExecContext(ctx, "INSERT INTO template_tasks (template_id, title, description, day_of_week, tags, urgent, important) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			templateID, task.Title, task.Description, task.DayOfWeek, task.Tags, task.Urgent, task.Important)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertTemplate stores a new template in one transaction.
+func insertTemplate(ctx context.Context, name string, tasks []TemplateTask) (Template, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Template{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO templates (name) VALUES (?)", name)
+	if err != nil {
+		return Template{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Template{}, err
+	}
+	if err := storeTemplateTasks(ctx, tx, int(id), tasks); err != nil {
+		return Template{}, err
+	}
+	template, err := loadTemplate(ctx, tx, int(id))
+	if err != nil {
+		return Template{}, err
+	}
+	return template, tx.Commit()
+}
+
+// templateOf turns the tasks of a week into template tasks, ordered by day
+// and then by their position in the day. Checklist items are unchecked.
+func templateOf(tasks []Task) []TemplateTask {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return weekdayOffsets[tasks[i].DayOfWeek] < weekdayOffsets[tasks[j].DayOfWeek]
+	})
+	templateTasks := make([]TemplateTask, 0, len(tasks))
+	for _, task := range tasks {
+		templateTasks = append(templateTasks, TemplateTask{
+			Title:       task.Title,
+			Description: resetChecklist(task.Description),
+			DayOfWeek:   task.DayOfWeek,
+			Tags:        task.Tags,
+			Urgent:      task.Urgent,
+			Important:   task.Important,
+		})
+	}
+	return templateTasks
+}
+
+// pathTemplate loads the template named by the path, writing the problem
+// response when it does not exist.
+func pathTemplate(w http.ResponseWriter, r *http.Request) (Template, bool) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid template ID", "id", idStr, "error", err)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidID, "Template ID must be an integer")
+		return Template{}, false
+	}
+
+	template, err := loadTemplate(r.Context(), db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Template not found", "template_id", id)
+		writeProblem(w, r, http.StatusNotFound, codeTemplateNotFound, "Template not found")
+		return Template{}, false
+	}
+	if err != nil {
+		logger.Error("Database query failed", "template_id", id, "error", err)
+		writeInternalError(w, r)
+		return Template{}, false
+	}
+	return template, true
+}
+
+// listTemplates returns every template with its tasks, by name.
+func listTemplates(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	rows, err := db.QueryContext(r.Context(), "SELECT id FROM templates ORDER BY name COLLATE NOCASE, id")
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			logger.Error("Row scan failed", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	templates := []Template{}
+	for _, id := range ids {
+		template, err := loadTemplate(r.Context(), db, id)
+		if err != nil {
+			logger.Error("Database query failed", "template_id", id, "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		templates = append(templates, template)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+func getTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := pathTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func createTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	var req TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	if fieldErrors := req.validate(); len(fieldErrors) > 0 {
+		logger.Warn("Template validation failed", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	template, err := insertTemplate(r.Context(), req.Name, req.Tasks)
+	if err != nil {
+		logger.Error("Database insert failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Template created", "template_id", template.ID, "tasks", len(template.Tasks))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+func updateTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	template, ok := pathTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	var req TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	if fieldErrors := req.validate(); len(fieldErrors) > 0 {
+		logger.Warn("Template validation failed", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(r.Context(), "UPDATE templates SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", req.Name, template.ID)
+	if err == nil {
+		err = storeTemplateTasks(r.Context(), tx, template.ID, req.Tasks)
+	}
+	if err == nil {
+		template, err = loadTemplate(r.Context(), tx, template.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Database update failed", "template_id", template.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Template updated", "template_id", template.ID, "tasks", len(template.Tasks))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	template, ok := pathTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(r.Context(), "DELETE FROM template_tasks WHERE template_id = ?", template.ID)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "DELETE FROM templates WHERE id = ?", template.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Database delete failed", "template_id", template.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Template deleted", "template_id", template.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Template deleted successfully"})
+}
+
+// applyTemplate creates the tasks of a template in the week given by the
+// week query parameter, or the current week, after the tasks already there.
+func applyTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	template, ok := pathTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	weekDate := getWeekStart(time.Now().In(timezone)).Format("2006-01-02")
+	if week := r.URL.Query().Get("week"); week != "" {
+		if weekDate, ok = normalizeWeekDate(week); !ok {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid query parameter",
+				FieldError{Field: "week", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+			return
+		}
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	tasks := make([]Task, 0, len(template.Tasks))
+	for _, templateTask := range template.Tasks {
+		fields := taskFields{Title: templateTask.Title, Description: templateTask.Description, DayOfWeek: templateTask.DayOfWeek, WeekDate: weekDate, Tags: templateTask.Tags, Urgent: templateTask.Urgent, Important: templateTask.Important}
+		task, err := insertTask(r.Context(), tx, fields)
+		if err != nil {
+			logger.Error("Database insert failed", "template_id", template.ID, "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		tasks = append(tasks, task)
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Database insert failed", "template_id", template.ID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Template applied", "template_id", template.ID, "week", weekDate, "tasks", len(tasks))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// saveWeekAsTemplate stores the tasks of a week as a new template. It takes
+// the same filters as GET /api/tasks/week/{weekDate}, so the template holds
+// the tasks that list shows.
+func saveWeekAsTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	weekDate, ok := normalizeWeekDate(r.PathValue("weekDate"))
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Invalid path parameter",
+			FieldError{Field: "weekDate", Code: fieldInvalid, Message: "must be a date in YYYY-MM-DD format"})
+		return
+	}
+	filters, fieldErrors := parseListFilters(r)
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
+	}
+
+	var req SaveTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("JSON decode failed", "error", err)
+		writeDecodeError(w, r, err)
+		return
+	}
+	fieldErrors = validateTemplateName(&req.Name)
+
+	tasks, err := queryTasks(r.Context(), db, "week_date = ?"+filters.where, append([]interface{}{weekDate}, filters.args...)...)
+	if err != nil {
+		logger.Error("Database query failed", "week", weekDate, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	switch {
+	case len(tasks) == 0:
+		fieldErrors = append(fieldErrors, FieldError{Field: "weekDate", Code: fieldInvalid, Message: "the week has no tasks to save"})
+	case len(tasks) > config.Limits.MaxBulkOperations:
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "weekDate",
+			Code:    fieldTooMany,
+			Message: fmt.Sprintf("the week has %d tasks, a template can have at most %d", len(tasks), config.Limits.MaxBulkOperations),
+		})
+	}
+	if len(fieldErrors) > 0 {
+		logger.Warn("Template validation failed", "errors", fieldErrors)
+		writeValidationError(w, r, fieldErrors)
+		return
+	}
+
+	template, err := insertTemplate(r.Context(), req.Name, templateOf(tasks))
+	if err != nil {
+		logger.Error("Database insert failed", "week", weekDate, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Week saved as template", "week", weekDate, "template_id", template.ID, "tasks", len(template.Tasks))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
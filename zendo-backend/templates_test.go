@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	c := newTestClient(t)
+
+	for _, task := range []string{
+		`{"title":"Review","dayOfWeek":"friday","weekDate":"2024-01-07"}`,
+		`{"title":"Standup","dayOfWeek":"mon","weekDate":"2024-01-07","tags":"work","description":"- [x] notes\n- [ ] plan"}`,
+		`{"title":"Inbox","dayOfWeek":"monday","weekDate":"2024-01-07","urgent":true}`,
+	} {
+		c.call("POST", "/api/tasks", task)
+	}
+
+	status, data := c.call("POST", "/api/tasks/week/2024-01-07/template", `{"name":" Routine "}`)
+	var template Template
+	if err := json.Unmarshal(data, &template); err != nil || status != http.StatusCreated {
+		t.Fatalf("save week: status %d, body %s", status, data)
+	}
+	if template.Name != "Routine" || len(template.Tasks) != 3 {
+		t.Fatalf("saved template = %+v", template)
+	}
+	if got := template.Tasks[0]; got.Title != "Standup" || got.Description != "- [ ] notes\n- [ ] plan" || got.Tags != "work" {
+		t.Errorf("first template task = %+v", got)
+	}
+	if got := template.Tasks[2].Title; got != "Review" {
+		t.Errorf("last template task = %s, want Review", got)
+	}
+
+	status, data = c.call("POST", fmt.Sprintf("/api/templates/%d/apply?week=2024-01-17", template.ID), "")
+	var tasks []Task
+	if err := json.Unmarshal(data, &tasks); err != nil || status != http.StatusCreated {
+		t.Fatalf("apply: status %d, body %s", status, data)
+	}
+	if len(tasks) != 3 || tasks[0].WeekDate != "2024-01-14" || tasks[0].DayOfWeek != "monday" || tasks[1].Urgent != true || tasks[0].Completed {
+		t.Errorf("applied tasks = %+v", tasks)
+	}
+
+	status, data = c.call("POST", "/api/templates", `{"name":"Bad","tasks":[{"title":"","dayOfWeek":"someday"}]}`)
+	var problem Problem
+	if err := json.Unmarshal(data, &problem); err != nil || status != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid template: status %d, body %s", status, data)
+	}
+	if len(problem.Errors) != 2 || problem.Errors[0].Field != "tasks[0].title" || problem.Errors[1].Field != "tasks[0].dayOfWeek" {
+		t.Errorf("invalid template errors = %+v", problem.Errors)
+	}
+
+	path := fmt.Sprintf("/api/templates/%d", template.ID)
+	if status, data := c.call("PUT", path, `{"name":"Mondays","tasks":[{"title":"Plan","dayOfWeek":"1"}]}`); status != http.StatusOK {
+		t.Errorf("update: status %d, body %s", status, data)
+	}
+	_, data = c.call("GET", "/api/templates", "")
+	var templates []Template
+	if err := json.Unmarshal(data, &templates); err != nil || len(templates) != 1 || templates[0].Name != "Mondays" || len(templates[0].Tasks) != 1 {
+		t.Errorf("templates = %s", data)
+	}
+	c.call("DELETE", path, "")
+	if status, _ := c.call("POST", path+"/apply", ""); status != http.StatusNotFound {
+		t.Errorf("apply deleted template: status %d, want 404", status)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newTLSConfig returns the TLS configuration for the main listener. In ACME
+// mode it also returns the handler for HTTP-01 challenges, which wraps the
+// fallback handler of the redirect listener; otherwise that is nil.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, func(http.Handler) http.Handler, error) {
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}, nil, nil
+	}
+
+	client := &acme.Client{DirectoryURL: cfg.ACME.DirectoryURL}
+	if cfg.ACME.CAFile != "" {
+		pem, err := os.ReadFile(cfg.ACME.CAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading ACME CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", cfg.ACME.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.ACME.Domains...),
+		Cache:      autocert.DirCache(cfg.ACME.CacheDir),
+		Email:      cfg.ACME.Email,
+		Client:     client,
+	}
+	tlsConfig := manager.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	return tlsConfig, manager.HTTPHandler, nil
+}
+
+// redirectToHTTPS redirects plain HTTP requests to the same host and path on
+// the HTTPS listener.
+func redirectToHTTPS(tlsListen string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsListen)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// strictTransportSecurity adds the HSTS header to every response so browsers
+// keep using HTTPS for maxAge seconds.
+func strictTransportSecurity(next http.Handler, maxAge int) http.Handler {
+	if maxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.Itoa(maxAge)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listenAndServe starts server with TLS when it has a TLS configuration.
+// Certificates come from the configuration, so no files are passed here.
+func listenAndServe(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
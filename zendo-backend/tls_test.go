@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, tc := range []struct{ listen, host, want string }{
+		{":443", "zendo.lan", "https://zendo.lan/api/tasks?tag=work"},
+		{":443", "zendo.lan:80", "https://zendo.lan/api/tasks?tag=work"},
+		{":8443", "zendo.lan:8080", "https://zendo.lan:8443/api/tasks?tag=work"},
+		{"0.0.0.0:8443", "192.168.1.5", "https://192.168.1.5:8443/api/tasks?tag=work"},
+	} {
+		req := httptest.NewRequest("GET", "http://"+tc.host+"/api/tasks?tag=work", nil)
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tc.listen).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tc.want {
+			t.Errorf("listen %s, host %s: %d to %q, want 308 to %q", tc.listen, tc.host, rec.Code, rec.Header().Get("Location"), tc.want)
+		}
+	}
+}
+
+func TestStrictTransportSecurity(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		maxAge int
+		want   string
+	}{
+		{31536000, "max-age=31536000"},
+		{0, ""},
+	} {
+		rec := httptest.NewRecorder()
+		strictTransportSecurity(ok, tc.maxAge).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if got := rec.Header().Get("Strict-Transport-Security"); got != tc.want {
+			t.Errorf("max age %d: header %q, want %q", tc.maxAge, got, tc.want)
+		}
+	}
+}
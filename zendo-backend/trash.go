@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Deleting a task moves it to the trash by setting deleted_at. Trashed tasks
+// are left out of every list and lookup, but keep their comments, events,
+// attachments and position: the ranking in rank.go and move.go still counts
+// them, so a restored task returns to its place in the day. The trash is
+// purged once tasks have been in it for Trash.Retention.
+
+// trashPurgeInterval is how often the trash is checked for expired tasks.
+const trashPurgeInterval = time.Hour
+
+// loadTaskIncludingTrash is loadTask for tasks that may be in the trash.
+func loadTaskIncludingTrash(ctx context.Context, q queryer, id int) (Task, error) {
+	var task Task
+	err := scanTask(q.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = ?", id), &task)
+	return task, err
+}
+
+// untrashTask takes a task out of the trash. It returns sql.ErrNoRows when
+// the task is not in the trash.
+func untrashTask(ctx context.Context, q queryer, id int) (Task, error) {
+	result, err := q.ExecContext(ctx, "UPDATE tasks SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err := checkAffected(result, err); err != nil {
+		return Task{}, err
+	}
+	task, err := loadTask(ctx, q, id)
+	if err != nil {
+		return Task{}, err
+	}
+	return task, writeAuditRecord(ctx, q, auditRestore, id, nil, &task)
+}
+
+// purgeTask deletes a trashed task for good, with its comments, events and
+// attachment records. The files are left for releaseBlobs, which must run
+// after the transaction commits. The audit log keeps the task's history.
+func purgeTask(ctx context.Context, q queryer, id int) error {
+	for _, table := range []string{"attachments", "comments", "task_events"} {
+		if _, err := q.ExecContext(ctx, "DELETE FROM "+table+" WHERE task_id = ?", id); err != nil {
+			return err
+		}
+	}
+	result, err := q.ExecContext(ctx, "DELETE FROM tasks WHERE id = ? AND deleted_at IS NOT NULL", id)
+	return checkAffected(result, err)
+}
+
+// purgeTrash deletes the tasks trashed before cutoff, in one transaction.
+func purgeTrash(ctx context.Context, cutoff time.Time) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// deleted_at is stored in the UTC format of CURRENT_TIMESTAMP.
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM tasks WHERE deleted_at IS NOT NULL AND deleted_at < ?", cutoff.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := purgeTask(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if len(ids) > 0 {
+		releaseBlobs(ctx)
+	}
+	return len(ids), nil
+}
+
+// startTrashPurger purges expired tasks from the trash at startup and then
+// every trashPurgeInterval, unless the retention is empty. It stops when ctx
+// is cancelled.
+func startTrashPurger(ctx context.Context) {
+	if config.Trash.Retention == "" {
+		return
+	}
+
+	// The retention was checked when the config was loaded.
+	retention, _ := time.ParseDuration(config.Trash.Retention)
+
+	slog.Info("Trash purging enabled", "retention", retention)
+
+	backgroundJobs.Add(1)
+	go func() {
+		defer backgroundJobs.Done()
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			runTrashPurge(ctx, time.Now().Add(-retention))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runTrashPurge is one scheduled run of purgeTrash, logged and counted in
+// the metrics. A run cut short by shutdown is not counted.
+func runTrashPurge(ctx context.Context, cutoff time.Time) {
+	purged, err := purgeTrash(ctx, cutoff)
+	switch {
+	case err != nil && ctx.Err() != nil:
+	case err != nil:
+		slog.Error("Purging the trash failed", "error", err)
+		trashPurgeRunsTotal.inc("error")
+	default:
+		if purged > 0 {
+			slog.Info("Purged tasks from the trash", "count", purged)
+		}
+		trashPurgeRunsTotal.inc("success")
+		trashPurgedTasksTotal.add(float64(purged))
+	}
+}
+
+// getTrash lists the tasks in the trash, most recently deleted first.
+func getTrash(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	where, args, fieldErrors := parseProjectFilter(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		writeInvalidFilters(w, r, fieldErrors)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NOT NULL"+where+" ORDER BY deleted_at DESC, id DESC", args...)
+	if err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		var task Task
+		if err := scanTask(rows, &task); err != nil {
+			logger.Error("Row scan failed", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("Database query failed", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// restoreTask takes a task out of the trash.
+func restoreTask(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn("Invalid task ID", "id", idStr, "error", err)
+		writeInvalidID(w, r)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	task, err := untrashTask(r.Context(), tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Task not in trash", "task_id", id)
+		writeProblem(w, r, http.StatusNotFound, codeTaskNotFound, "Task not found in trash")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Database update failed", "task_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	logger.Info("Task restored from trash", "task_id", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
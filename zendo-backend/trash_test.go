@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	c := newTestClient(t)
+
+	var ids []int
+	for _, title := range []string{"A", "B", "C"} {
+		_, data := c.call("POST", "/api/tasks", fmt.Sprintf(`{"title":%q,"dayOfWeek":"monday","weekDate":"2024-01-07"}`, title))
+		var task Task
+		c.decode(data, &task)
+		ids = append(ids, task.ID)
+	}
+	b := fmt.Sprintf("/api/tasks/%d", ids[1])
+
+	c.call("DELETE", b, "")
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "A,C" {
+		t.Errorf("week after delete = %s, want A,C", got)
+	}
+	if status, _ := c.call("GET", b, ""); status != http.StatusNotFound {
+		t.Errorf("get trashed task: status %d, want 404", status)
+	}
+	if status, _ := c.call("PUT", b, `{"title":"B2","dayOfWeek":"monday","weekDate":"2024-01-07"}`); status != http.StatusNotFound {
+		t.Errorf("update trashed task: status %d, want 404", status)
+	}
+	if got := c.titles("/api/trash"); got != "B" {
+		t.Errorf("trash = %s, want B", got)
+	}
+
+	// Moving C right after A leaves B's place free.
+	if status, data := c.call("POST", fmt.Sprintf("/api/tasks/%d/reorder", ids[2]), fmt.Sprintf(`{"after":%d}`, ids[0])); status != http.StatusOK {
+		t.Fatalf("reorder: status %d, body %s", status, data)
+	}
+	if status, data := c.call("POST", b+"/restore", ""); status != http.StatusOK {
+		t.Fatalf("restore: status %d, body %s", status, data)
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "A,C,B" {
+		t.Errorf("week after restore = %s, want A,C,B", got)
+	}
+	if status, _ := c.call("POST", b+"/restore", ""); status != http.StatusNotFound {
+		t.Errorf("restore of a task not in the trash: status %d, want 404", status)
+	}
+	_, data := c.call("GET", b+"/history", "")
+	var history []AuditRecord
+	if err := json.Unmarshal(data, &history); err != nil || len(history) == 0 || history[0].Action != auditRestore {
+		t.Errorf("history after restore = %s", data)
+	}
+
+	c.call("DELETE", b, "")
+	if n, err := purgeTrash(context.Background(), time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("purge before retention: %d, %v", n, err)
+	}
+	if n, err := purgeTrash(context.Background(), time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("purge after retention: %d, %v", n, err)
+	}
+	if got := c.titles("/api/trash"); got != "" {
+		t.Errorf("trash after purge = %s", got)
+	}
+	if status, _ := c.call("POST", b+"/restore", ""); status != http.StatusNotFound {
+		t.Errorf("restore of a purged task: status %d, want 404", status)
+	}
+}
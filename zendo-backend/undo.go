@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// The operation journal lets a client undo and redo its own recent changes.
+// Every request sent with an X-Zendo-Session header is one operation, and
+// writeAuditRecord journals the state each task it changed had before and
+// after it. Undoing an operation puts its tasks back in their before state
+// and redoing it in their after state, but only while nobody has changed
+// them in between. Tasks that did not exist before an operation are moved to
+// the trash by its undo.
+
+const (
+	// maxJournalOperations is how many operations a session can undo.
+	maxJournalOperations = 50
+	// journalTTL is how long an operation can be undone.
+	journalTTL = 24 * time.Hour
+)
+
+// UndoResponse is the body of POST /api/undo and /api/redo: the tasks of the
+// operation as they are now. Tasks in the trash have deletedAt set.
+type UndoResponse struct {
+	Operation int    `json:"operation"`
+	Tasks     []Task `json:"tasks"`
+}
+
+// undoConflict is the problem sent when tasks of the operation have changed
+// since, listing them as an extension member.
+type undoConflict struct {
+	Problem
+	TaskIDs []int `json:"taskIds"`
+}
+
+// journalEntry is the state of one task before and after an operation. A nil
+// state means the task did not exist or was in the trash.
+type journalEntry struct {
+	TaskID int
+	Before *Task
+	After  *Task
+}
+
+// journalChange adds a change to the operation of the request, if it has
+// one. before and after are task states encoded by auditJSON.
+func journalChange(ctx context.Context, q queryer, taskID int, before, after interface{}) error {
+	info := auditFrom(ctx)
+	if info.Operation == "" {
+		return nil
+	}
+
+	// The operation is looked up by key rather than remembered, so it is
+	// created again when a bulk savepoint rolled it back.
+	result, err := q.ExecContext(ctx, "INSERT INTO operations (session, key) VALUES (?, ?) ON CONFLICT (key) DO NOTHING", info.Session, info.Operation)
+	if err != nil {
+		return err
+	}
+	if created, err := result.RowsAffected(); err != nil {
+		return err
+	} else if created > 0 {
+		if err := trimJournal(ctx, q, info.Session); err != nil {
+			return err
+		}
+	}
+	var operationID int
+	if err := q.QueryRowContext(ctx, "SELECT id FROM operations WHERE key = ?", info.Operation).Scan(&operationID); err != nil {
+		return err
+	}
+
+	// Several changes to one task keep the first before and the last after.
+	_, err = q.ExecContext(ctx, `INSERT INTO operation_tasks (operation_id, task_id, before, after) VALUES (?, ?, ?, ?)
+		ON CONFLICT (operation_id, task_id) DO UPDATE SET after = excluded.after`,
+		operationID, taskID, before, after)
+	return err
+}
+
+// trimJournal runs when a session starts a new operation: the operations it
+// had undone can no longer be redone, and old operations are dropped.
+func trimJournal(ctx context.Context, q queryer, session string) error {
+	cutoff := time.Now().Add(-journalTTL).UTC().Format("2006-01-02 15:04:05.000")
+	_, err := q.ExecContext(ctx, `DELETE FROM operations WHERE created_at < ?
+		OR (session = ? AND (undone OR id NOT IN (SELECT id FROM operations WHERE session = ? ORDER BY id DESC LIMIT ?)))`,
+		cutoff, session, session, maxJournalOperations)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, "DELETE FROM operation_tasks WHERE operation_id NOT IN (SELECT id FROM operations)")
+	return err
+}
+
+func loadJournalEntries(ctx context.Context, q queryer, operationID int) ([]journalEntry, error) {
+	rows, err := q.QueryContext(ctx, "SELECT task_id, before, after FROM operation_tasks WHERE operation_id = ? ORDER BY rowid", operationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []journalEntry
+	for rows.Next() {
+		var entry journalEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.TaskID, &before, &after); err != nil {
+			return nil, err
+		}
+		if entry.Before, err = decodeTaskState(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = decodeTaskState(after); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// stateMatches reports whether a task, nil once purged, is still in the
+// state an operation left it in. Positions are not compared: rebalancing a
+// day rewrites them without being journaled.
+func stateMatches(current, state *Task) bool {
+	if current == nil {
+		return false
+	}
+	if state == nil {
+		return current.DeletedAt != nil
+	}
+	a, b := *state, *current
+	a.Position, b.Position = "", ""
+	return current.DeletedAt == nil && len(taskChanges(&a, &b)) == 0
+}
+
+// keepsPlace reports whether an entry left the task where it was in its day,
+// in which case replaying it must not touch the position either.
+func keepsPlace(entry journalEntry) bool {
+	return entry.Before != nil && entry.After != nil && entry.Before.Position == entry.After.Position &&
+		entry.Before.WeekDate == entry.After.WeekDate && entry.Before.DayOfWeek == entry.After.DayOfWeek
+}
+
+// applyTaskState puts a task in a journaled state, taking it out of the trash
+// if needed; a nil state moves it to the trash. With keepPosition the task
+// keeps its current position. The changes are recorded like any other.
+func applyTaskState(ctx context.Context, q queryer, id int, state *Task, keepPosition bool) (Task, error) {
+	current, err := loadTaskIncludingTrash(ctx, q, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if state != nil && keepPosition {
+		kept := *state
+		kept.Position = current.Position
+		state = &kept
+	}
+	if state == nil {
+		if current.DeletedAt != nil {
+			return current, nil
+		}
+		if err := removeTask(ctx, q, id); err != nil {
+			return Task{}, err
+		}
+		return loadTaskIncludingTrash(ctx, q, id)
+	}
+	if current.DeletedAt != nil {
+		if current, err = untrashTask(ctx, q, id); err != nil {
+			return Task{}, err
+		}
+	}
+	if len(taskChanges(&current, state)) == 0 {
+		return current, nil
+	}
+	projectID, err := existingProject(ctx, q, projectOf(state))
+	if err != nil {
+		return Task{}, err
+	}
+
+	// The old position is restored even if another task has taken it since;
+	// reordering copes with equal positions by rebalancing the day.
+	result, err := q.ExecContext(ctx, `UPDATE tasks SET title = ?, description = ?, completed = ?, day_of_week = ?, week_date = ?, tags = ?, urgent = ?, important = ?,
+		project_id = ?, position = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		state.Title, state.Description, state.Completed, state.DayOfWeek, state.WeekDate, state.Tags, state.Urgent, state.Important,
+		projectColumn(projectID), state.Position, id)
+	if err := checkAffected(result, err); err != nil {
+		return Task{}, err
+	}
+	return reloadTask(ctx, q, &current)
+}
+
+func undoOperation(w http.ResponseWriter, r *http.Request) {
+	replayOperation(w, r, true)
+}
+
+func redoOperation(w http.ResponseWriter, r *http.Request) {
+	replayOperation(w, r, false)
+}
+
+// replayOperation undoes the last operation of the session, or redoes the
+// one it undid last, in one transaction.
+func replayOperation(w http.ResponseWriter, r *http.Request, undo bool) {
+	logger := requestLogger(r)
+
+	info := auditFrom(r.Context())
+	if info.Session == "" {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidParameter, "Missing header",
+			FieldError{Field: "X-Zendo-Session", Code: fieldRequired, Message: "is required"})
+		return
+	}
+	// Undo and redo move within the journal rather than adding to it.
+	info.Operation = ""
+	ctx := withAudit(r.Context(), info)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	query := "SELECT id FROM operations WHERE session = ? AND created_at >= ? AND NOT undone ORDER BY id DESC LIMIT 1"
+	if !undo {
+		query = "SELECT id FROM operations WHERE session = ? AND created_at >= ? AND undone ORDER BY id LIMIT 1"
+	}
+	cutoff := time.Now().Add(-journalTTL).UTC().Format("2006-01-02 15:04:05.000")
+	var operationID int
+	err = tx.QueryRowContext(ctx, query, info.Session, cutoff).Scan(&operationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if undo {
+			writeProblem(w, r, http.StatusConflict, codeNothingToUndo, "There is no operation to undo")
+		} else {
+			writeProblem(w, r, http.StatusConflict, codeNothingToRedo, "There is no operation to redo")
+		}
+		return
+	}
+	var entries []journalEntry
+	if err == nil {
+		entries, err = loadJournalEntries(ctx, tx, operationID)
+	}
+	if err != nil {
+		logger.Error("Failed to load operation", "operation", operationID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if undo {
+		slices.Reverse(entries)
+	}
+
+	var conflicts []int
+	for _, entry := range entries {
+		expected := entry.Before
+		if undo {
+			expected = entry.After
+		}
+		current, err := loadTaskIncludingTrash(ctx, tx, entry.TaskID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logger.Error("Database query failed", "task_id", entry.TaskID, "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		var currentState *Task
+		if err == nil {
+			currentState = &current
+		}
+		if !stateMatches(currentState, expected) {
+			conflicts = append(conflicts, entry.TaskID)
+		}
+	}
+	if len(conflicts) > 0 {
+		logger.Warn("Operation conflicts with later changes", "operation", operationID, "undo", undo, "task_ids", conflicts)
+		writeProblemBody(w, http.StatusConflict, undoConflict{
+			Problem: newProblem(r, http.StatusConflict, codeUndoConflict, "Tasks of the operation were changed since"),
+			TaskIDs: conflicts,
+		})
+		return
+	}
+
+	tasks := []Task{}
+	for _, entry := range entries {
+		state := entry.After
+		if undo {
+			state = entry.Before
+		}
+		task, err := applyTaskState(ctx, tx, entry.TaskID, state, keepsPlace(entry))
+		if err != nil {
+			logger.Error("Failed to apply operation", "operation", operationID, "task_id", entry.TaskID, "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		tasks = append(tasks, task)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE operations SET undone = ? WHERE id = ?", undo, operationID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Failed to commit operation", "operation", operationID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	if undo {
+		logger.Info("Operation undone", "operation", operationID, "tasks", len(tasks))
+	} else {
+		logger.Info("Operation redone", "operation", operationID, "tasks", len(tasks))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UndoResponse{Operation: operationID, Tasks: tasks})
+}
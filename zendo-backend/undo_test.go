@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	c := newTestClient(t)
+
+	// call sends a request from the given session.
+	call := func(method, path, session, body string) (int, []byte) {
+		t.Helper()
+		return c.call(method, path, body, "X-Zendo-Session", session)
+	}
+	replay := func(path, session string) UndoResponse {
+		t.Helper()
+		status, data := call("POST", path, session, "")
+		var resp UndoResponse
+		if status != http.StatusOK || json.Unmarshal(data, &resp) != nil {
+			t.Fatalf("POST %s: status %d, body %s", path, status, data)
+		}
+		return resp
+	}
+
+	_, data := call("POST", "/api/tasks", "ui", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	var task Task
+	c.decode(data, &task)
+	base := fmt.Sprintf("/api/tasks/%d", task.ID)
+	call("POST", base+"/move", "ui", `{"dayOfWeek":"friday"}`)
+	call("POST", "/api/tasks/bulk", "ui", fmt.Sprintf(`{"operations":[{"op":"complete","id":%d},{"op":"create","task":{"title":"Review","dayOfWeek":"monday","weekDate":"2024-01-07"}}]}`, task.ID))
+
+	// The bulk request is one operation.
+	resp := replay("/api/undo", "ui")
+	if len(resp.Tasks) != 2 || resp.Tasks[0].DeletedAt == nil || resp.Tasks[1].Completed {
+		t.Errorf("undo bulk = %+v", resp.Tasks)
+	}
+	if got := c.task(task.ID); got.DayOfWeek != "friday" || got.Completed {
+		t.Errorf("after undoing bulk: %+v", got)
+	}
+	replay("/api/undo", "ui")
+	if got := c.task(task.ID); got.DayOfWeek != "monday" || got.Position != task.Position {
+		t.Errorf("after undoing move: day %s, position %q, want monday, %q", got.DayOfWeek, got.Position, task.Position)
+	}
+	replay("/api/redo", "ui")
+	if got := c.task(task.ID); got.DayOfWeek != "friday" {
+		t.Errorf("after redoing move: day %s, want friday", got.DayOfWeek)
+	}
+
+	// A change from another session blocks undoing the redone move.
+	call("PUT", base, "other", `{"title":"Plan Q3","dayOfWeek":"friday","weekDate":"2024-01-07"}`)
+	status, data := call("POST", "/api/undo", "ui", "")
+	var conflict struct {
+		Code    string `json:"code"`
+		TaskIDs []int  `json:"taskIds"`
+	}
+	json.Unmarshal(data, &conflict)
+	if status != http.StatusConflict || conflict.Code != codeUndoConflict || len(conflict.TaskIDs) != 1 || conflict.TaskIDs[0] != task.ID {
+		t.Errorf("undo after another change: status %d, body %s", status, data)
+	}
+	if got := c.task(task.ID); got.Title != "Plan Q3" || got.DayOfWeek != "friday" {
+		t.Errorf("refused undo changed the task: %+v", got)
+	}
+
+	// The other session can undo its own change, after which ours applies.
+	replay("/api/undo", "other")
+	replay("/api/undo", "ui")
+	replay("/api/undo", "ui")
+	if status, data := call("GET", base, "", ""); status != http.StatusNotFound {
+		t.Errorf("undoing the creation left the task: status %d, body %s", status, data)
+	}
+	if status, data := call("POST", "/api/undo", "ui", ""); status != http.StatusConflict || !strings.Contains(string(data), codeNothingToUndo) {
+		t.Errorf("undo with nothing left: status %d, body %s", status, data)
+	}
+
+	// A new operation clears what could be redone.
+	call("POST", "/api/tasks", "ui", `{"title":"Other","dayOfWeek":"monday","weekDate":"2024-01-07"}`)
+	if status, data := call("POST", "/api/redo", "ui", ""); status != http.StatusConflict || !strings.Contains(string(data), codeNothingToRedo) {
+		t.Errorf("redo after a new operation: status %d, body %s", status, data)
+	}
+	if status, _ := call("POST", "/api/undo", "", ""); status != http.StatusBadRequest {
+		t.Errorf("undo without a session: status %d, want 400", status)
+	}
+}
+
+func TestUndoAfterRebalance(t *testing.T) {
+	c := newTestClient(t)
+	for _, title := range []string{"Plan", "Review", "Ship"} {
+		c.call("POST", "/api/tasks", fmt.Sprintf(`{"title":%q,"dayOfWeek":"monday","weekDate":"2024-01-07"}`, title))
+	}
+	c.call("POST", "/api/tasks/bulk", `{"operations":[{"op":"complete","id":1}]}`, "X-Zendo-Session", "ui")
+
+	// Equal keys make the next reorder rebalance the day, which rewrites
+	// the position of the completed task as well.
+	if _, err := db.Exec("UPDATE tasks SET position = (SELECT position FROM tasks WHERE id = 1) WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	before := c.task(1).Position
+	if status, data := c.call("POST", "/api/tasks/3/reorder", `{"after":1,"before":2}`); status != http.StatusOK {
+		t.Fatalf("reorder: status %d, body %s", status, data)
+	}
+	if c.task(1).Position == before {
+		t.Fatal("reorder did not rebalance the day")
+	}
+
+	status, data := c.call("POST", "/api/undo", "", "X-Zendo-Session", "ui")
+	if status != http.StatusOK {
+		t.Fatalf("undo after a rebalance: status %d, body %s", status, data)
+	}
+	if task := c.task(1); task.Completed {
+		t.Error("undo did not reopen the task")
+	}
+	if got := c.titles("/api/tasks/week/2024-01-07"); got != "Plan,Ship,Review" {
+		t.Errorf("week after undo = %s, want Plan,Ship,Review", got)
+	}
+
+	// A real change by someone else is still a conflict.
+	c.call("POST", "/api/redo", "", "X-Zendo-Session", "ui")
+	c.call("PUT", "/api/tasks/1", `{"title":"Plan more","dayOfWeek":"monday","weekDate":"2024-01-07","completed":true}`)
+	if status, _ := c.call("POST", "/api/undo", "", "X-Zendo-Session", "ui"); status != http.StatusConflict {
+		t.Errorf("undo after an edit: status %d, want 409", status)
+	}
+}
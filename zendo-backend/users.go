@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// API users are named bearer tokens for scripts and the command-line client,
+// managed with "zendo user". A request with a user's token is attributed to
+// that user in the audit log. Requests without a token are still served, as
+// the web app has no sign-in; an unknown token is treated as no token.
+
+// apiUser is a stored user. Only a hash of the token is kept.
+type apiUser struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+}
+
+type userKey struct{}
+
+// userFrom returns the user authenticated for the request, or "".
+func userFrom(ctx context.Context) string {
+	name, _ := ctx.Value(userKey{}).(string)
+	return name
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// hashToken returns the stored form of a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newUserToken returns a random 64 character hex token.
+func newUserToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// authenticate looks up the user whose token the request carries and stores
+// their name in the request context.
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var name string
+		err := db.QueryRowContext(r.Context(), "SELECT name FROM users WHERE token_hash = ?", hashToken(token)).Scan(&name)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			requestLogger(r).Error("Failed to look up API user", "error", err)
+			writeInternalError(w, r)
+			return
+		default:
+			r = r.WithContext(context.WithValue(r.Context(), userKey{}, name))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateUserName checks a user name, which is recorded as the actor of
+// the user's changes.
+func validateUserName(name string) error {
+	if name == "" {
+		return errors.New("a user name is required")
+	}
+	if n := utf8.RuneCountInString(name); n > maxActorLength {
+		return fmt.Errorf("user name must be at most %d characters, got %d", maxActorLength, n)
+	}
+	return nil
+}
+
+// addUser creates a user and returns their token, which is not stored and
+// cannot be shown again.
+func addUser(ctx context.Context, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if err := validateUserName(name); err != nil {
+		return "", err
+	}
+
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE name = ? COLLATE NOCASE", name).Scan(&n); err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "", fmt.Errorf("user %q already exists", name)
+	}
+
+	token := newUserToken()
+	if _, err := db.ExecContext(ctx, "INSERT INTO users (name, token_hash) VALUES (?, ?)", name, hashToken(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// resetUserToken gives a user a new token, revoking the old one.
+func resetUserToken(ctx context.Context, name string) (string, error) {
+	token := newUserToken()
+	result, err := db.ExecContext(ctx, "UPDATE users SET token_hash = ? WHERE name = ? COLLATE NOCASE", hashToken(token), strings.TrimSpace(name))
+	if err != nil {
+		return "", err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return "", fmt.Errorf("no user named %q", name)
+	}
+	return token, nil
+}
+
+// removeUser deletes a user. Their past changes keep their name in the audit log.
+func removeUser(ctx context.Context, name string) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM users WHERE name = ? COLLATE NOCASE", strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("no user named %q", name)
+	}
+	return nil
+}
+
+func listUsers(ctx context.Context) ([]apiUser, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, name, created_at FROM users ORDER BY name COLLATE NOCASE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []apiUser
+	for rows.Next() {
+		var user apiUser
+		if err := rows.Scan(&user.ID, &user.Name, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestUserTokens(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	token, err := addUser(ctx, " ana ")
+	if err != nil {
+		t.Fatalf("addUser: %v", err)
+	}
+	if _, err := addUser(ctx, "ANA"); err == nil {
+		t.Error("adding a user with a taken name succeeded")
+	}
+
+	actor := func(auth string) string {
+		t.Helper()
+		_, data := c.call("POST", "/api/tasks", `{"title":"Plan","dayOfWeek":"monday","weekDate":"2024-01-07"}`,
+			"Authorization", auth, "X-Zendo-Actor", "claimed")
+		var task Task
+		c.decode(data, &task)
+		_, data = c.call("GET", fmt.Sprintf("/api/tasks/%d/history", task.ID), "")
+		var history []AuditRecord
+		c.decode(data, &history)
+		return history[0].Actor
+	}
+	if got := actor("Bearer " + token); got != "ana" {
+		t.Errorf("actor with a user token = %q, want ana", got)
+	}
+	if got := actor("Bearer not-a-token"); got != "claimed" {
+		t.Errorf("actor with an unknown token = %q, want claimed", got)
+	}
+
+	newToken, err := resetUserToken(ctx, "Ana")
+	if err != nil {
+		t.Fatalf("resetUserToken: %v", err)
+	}
+	if got := actor("Bearer " + token); got != "claimed" {
+		t.Errorf("actor with a replaced token = %q, want claimed", got)
+	}
+	if err := removeUser(ctx, "ana"); err != nil {
+		t.Fatalf("removeUser: %v", err)
+	}
+	if got := actor("Bearer " + newToken); got != "claimed" {
+		t.Errorf("actor with a removed user's token = %q, want claimed", got)
+	}
+	if users, err := listUsers(ctx); err != nil || len(users) != 0 {
+		t.Errorf("users after removal = %+v, %v", users, err)
+	}
+	if err := removeUser(ctx, "ana"); err == nil {
+		t.Error("removing a missing user succeeded")
+	}
+}
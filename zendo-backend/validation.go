@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// daysOfWeek are the canonical day names stored in day_of_week, indexed by
+// time.Weekday.
+var daysOfWeek = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// taskFields are the user-editable fields of a task, shared by create and
+// update requests.
+type taskFields struct {
+	Title       string
+	Description string
+	DayOfWeek   string
+	WeekDate    string
+	Tags        string
+	Urgent      bool
+	Important   bool
+	ProjectID   *int // nil or 0 for none; saveTask keeps the project on nil
+}
+
+// fieldsOf returns the editable fields of a stored task.
+func fieldsOf(task *Task) taskFields {
+	return taskFields{Title: task.Title, Description: task.Description, DayOfWeek: task.DayOfWeek, WeekDate: task.WeekDate, Tags: task.Tags, Urgent: task.Urgent, Important: task.Important, ProjectID: projectOf(task)}
+}
+
+// validate normalizes the fields and checks them against the configured
+// limits. It returns one error per invalid field.
+func (f *taskFields) validate() []FieldError {
+	fieldErrors := f.normalize()
+	return append(fieldErrors, validateTaskLimits(f.Title, f.Description, f.Tags)...)
+}
+
+// normalize checks the format of the fields and rewrites them into their
+// canonical form: a trimmed title, a lowercase day name, the week start date
+// and a deduplicated tag list.
+func (f *taskFields) normalize() []FieldError {
+	var fieldErrors []FieldError
+	invalid := func(field, code, message string) {
+		fieldErrors = append(fieldErrors, FieldError{Field: field, Code: code, Message: message})
+	}
+
+	f.Title = strings.TrimSpace(f.Title)
+	if f.Title == "" {
+		invalid("title", fieldRequired, "is required")
+	}
+
+	f.Description = normalizeDescription(f.Description)
+
+	if strings.TrimSpace(f.DayOfWeek) == "" {
+		invalid("dayOfWeek", fieldRequired, "is required")
+	} else if day, ok := normalizeDayOfWeek(f.DayOfWeek); ok {
+		f.DayOfWeek = day
+	} else {
+		invalid("dayOfWeek", fieldInvalid, "must be a day name such as \"tuesday\" or \"Tue\", or a number from 0 (Sunday) to 6")
+	}
+
+	if strings.TrimSpace(f.WeekDate) == "" {
+		invalid("weekDate", fieldRequired, "is required")
+	} else if week, ok := normalizeWeekDate(f.WeekDate); ok {
+		f.WeekDate = week
+	} else {
+		invalid("weekDate", fieldInvalid, "must be a date in YYYY-MM-DD format")
+	}
+
+	f.Tags = normalizeTags(f.Tags)
+
+	return fieldErrors
+}
+
+// normalizeDayOfWeek turns "Tue", "tuesday" or "2" into "tuesday". Names may
+// be abbreviated to any unambiguous prefix of at least two letters; numbers
+// follow time.Weekday, with 0 for Sunday.
+func normalizeDayOfWeek(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.Atoi(s); err == nil {
+		if n >= 0 && n < len(daysOfWeek) {
+			return daysOfWeek[n], true
+		}
+		return "", false
+	}
+	if len(s) < 2 {
+		return "", false
+	}
+	match := ""
+	for _, day := range daysOfWeek {
+		if strings.HasPrefix(day, s) {
+			if match != "" {
+				return "", false
+			}
+			match = day
+		}
+	}
+	return match, match != ""
+}
+
+// normalizeWeekDate parses a YYYY-MM-DD date, or an RFC 3339 timestamp in
+// the configured timezone, and returns the Sunday starting its week. The
+// week start is not configurable; see getWeekStart.
+func normalizeWeekDate(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	date, err := time.ParseInLocation("2006-01-02", s, timezone)
+	if err != nil {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", false
+		}
+		date = t.In(timezone)
+	}
+	return getWeekStart(date).Format("2006-01-02"), true
+}
+
+// normalizeTags trims the comma-separated tags, drops empty ones and removes
+// duplicates, comparing case-insensitively and keeping the first spelling.
+func normalizeTags(s string) string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+	return strings.Join(tags, ",")
+}
+
+// normalizeDescription uses Unix line endings and drops leading and trailing
+// blank lines, keeping the indentation Markdown relies on.
+func normalizeDescription(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimRight(s, " \t\n")
+	for {
+		line, rest, found := strings.Cut(s, "\n")
+		if !found || strings.TrimSpace(line) != "" {
+			break
+		}
+		s = rest
+	}
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNormalizeDayOfWeek(t *testing.T) {
+	for in, want := range map[string]string{
+		"tuesday":   "tuesday",
+		" Tue ":     "tuesday",
+		"WED":       "wednesday",
+		"th":        "thursday",
+		"0":         "sunday",
+		"6":         "saturday",
+		"t":         "",
+		"s":         "",
+		"7":         "",
+		"-1":        "",
+		"someday":   "",
+		"tuesdays":  "",
+		"":          "",
+		"saturnday": "",
+	} {
+		got, ok := normalizeDayOfWeek(in)
+		if got != want || ok != (want != "") {
+			t.Errorf("normalizeDayOfWeek(%q) = %q, %t; want %q", in, got, ok, want)
+		}
+	}
+}
+
+func TestNormalizeWeekDate(t *testing.T) {
+	for in, want := range map[string]string{
+		"2024-01-07":           "2024-01-07", // a Sunday
+		"2024-01-10":           "2024-01-07",
+		" 2024-01-13 ":         "2024-01-07",
+		"2024-01-01":           "2023-12-31", // across a year boundary
+		"2024-01-10T23:30:00Z": "2024-01-07",
+		"2024-01-13T23:30:00Z": "2024-01-07",
+		"2024-01-13":           "2024-01-07",
+		"2024-1-7":             "",
+		"07/01/2024":           "",
+		"2024-02-30":           "",
+		"next week":            "",
+	} {
+		got, ok := normalizeWeekDate(in)
+		if got != want || ok != (want != "") {
+			t.Errorf("normalizeWeekDate(%q) = %q, %t; want %q", in, got, ok, want)
+		}
+	}
+
+	// Timestamps are placed in the configured timezone before finding the week.
+	saved := timezone
+	timezone = time.FixedZone("UTC+2", 2*60*60)
+	t.Cleanup(func() { timezone = saved })
+	if got, _ := normalizeWeekDate("2024-01-13T23:30:00Z"); got != "2024-01-14" {
+		t.Errorf("Saturday night UTC in UTC+2 = %q, want 2024-01-14", got)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                      "",
+		" work , home ":         "work,home",
+		"Work,work,WORK,home":   "Work,home",
+		",,a,, b ,":             "a,b",
+		"deep work, Deep Work ": "deep work",
+	} {
+		if got := normalizeTags(in); got != want {
+			t.Errorf("normalizeTags(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTaskValidation(t *testing.T) {
+	c := newTestClient(t)
+
+	status, data := c.call("POST", "/api/tasks", `{"title":"  Plan ","dayOfWeek":"Tue","weekDate":"2024-01-10","tags":"work, Work,home"}`)
+	var task Task
+	c.decode(data, &task)
+	if status != 201 || task.Title != "Plan" || task.DayOfWeek != "tuesday" || task.WeekDate != "2024-01-07" || task.Tags != "work,home" {
+		t.Errorf("created task: status %d, %+v", status, task)
+	}
+
+	status, data = c.call("POST", "/api/tasks", `{"title":" ","dayOfWeek":"someday","weekDate":"soon"}`)
+	var problem Problem
+	c.decode(data, &problem)
+	fields := fmt.Sprint(problem.Errors)
+	if status != 422 || len(problem.Errors) != 3 {
+		t.Errorf("invalid task: status %d, errors %s", status, fields)
+	}
+}